@@ -1,37 +1,335 @@
 package blscosi_bundle
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"reflect"
 
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle/protocol"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
 )
 
 // Client is a structure to communicate with the CoSi
 // service
 type Client struct {
 	*onet.Client
+	service string
+	suite   pairing.Suite
 }
 
 // NewClient instantiates a new blscosi_bundle.Client
 func NewClient() *Client {
-	return &Client{Client: onet.NewClient(suite, ServiceName)}
+	return &Client{Client: onet.NewClient(suite, ServiceName), service: ServiceName, suite: suite}
+}
+
+// NewClientWithSuite instantiates a client of the service registered under
+// the given name with RegisterService, with the same pairing suite.
+func NewClientWithSuite(serviceName string, suite pairing.Suite) (*Client, error) {
+	s, ok := suite.(suites.Suite)
+	if !ok {
+		return nil, fmt.Errorf("%s can't be used for the keys of the servers", protocol.SuiteName(suite))
+	}
+	return &Client{Client: onet.NewClient(s, serviceName), service: serviceName, suite: suite}, nil
+}
+
+// ServiceName returns the name of the service that the client talks to,
+// whose keys make the signatures.
+func (c *Client) ServiceName() string {
+	return c.service
+}
+
+// PairingSuite returns the pairing suite that the signatures are made with.
+func (c *Client) PairingSuite() pairing.Suite {
+	return c.suite
+}
+
+// PartialSignatureError is returned when the session ended before enough
+// nodes signed. Response holds the partial signature, its signers and the
+// indices of the missing nodes.
+type PartialSignatureError struct {
+	Response *SignatureResponse
+}
+
+func (e *PartialSignatureError) Error() string {
+	return fmt.Sprintf("signature below the threshold: %d signers, %d required, missing %v",
+		e.Response.Signers, e.Response.Threshold, e.Response.Missing)
+}
+
+// ServiceError is returned when the service of a node received the request
+// and rejected it. The request isn't sent to the other nodes, since they
+// would reject it too.
+type ServiceError struct {
+	Node *network.ServerIdentity
+	Err  error
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("%v rejected the request: %v", e.Node, e.Err)
 }
 
 // SignatureRequest sends a CoSi sign request to the Cothority defined by the given
 // Roster
 func (c *Client) SignatureRequest(r *onet.Roster, msg []byte) (*SignatureResponse, error) {
-	serviceReq := &SignatureRequest{
+	return c.SignatureRequestWithData(r, msg, nil)
+}
+
+// SignatureRequestWithPolicy sends a CoSi sign request to the Cothority
+// defined by the given Roster, requiring the signatures of the policy
+func (c *Client) SignatureRequestWithPolicy(r *onet.Roster, msg []byte, policy protocol.Policy) (*SignatureResponse, error) {
+	return c.send(r, &SignatureRequest{
 		Roster:  r,
 		Message: msg,
-	}
+		Policy:  policy,
+	})
+}
+
+// SignatureRequestWithWeights sends a CoSi sign request to the Cothority
+// defined by the given Roster, where the threshold applies to the sum of
+// the weights of the signers. Weights are in the order of the roster.
+func (c *Client) SignatureRequestWithWeights(r *onet.Roster, msg []byte, weights []int) (*SignatureResponse, error) {
+	return c.send(r, &SignatureRequest{
+		Roster:  r,
+		Message: msg,
+		Weights: weights,
+	})
+}
+
+// SignatureRequestWithGroups sends a CoSi sign request to the Cothority
+// defined by the given Roster, where each group must have enough signers on
+// top of the threshold. Weights are optional, as for
+// SignatureRequestWithWeights.
+func (c *Client) SignatureRequestWithGroups(r *onet.Roster, msg []byte, weights []int, groups []protocol.Group) (*SignatureResponse, error) {
+	return c.send(r, &SignatureRequest{
+		Roster:  r,
+		Message: msg,
+		Weights: weights,
+		Groups:  groups,
+	})
+}
+
+// SendSignatureRequest sends the request to the Cothority defined by its
+// Roster as is, for the options that have no dedicated method, like the
+// parameters of the protocol.
+func (c *Client) SendSignatureRequest(req *SignatureRequest) (*SignatureResponse, error) {
+	return c.send(req.Roster, req)
+}
+
+// SignatureRequestWithData sends a CoSi sign request to the Cothority defined
+// by the given Roster, with additional data for the verification of msg
+func (c *Client) SignatureRequestWithData(r *onet.Roster, msg, data []byte) (*SignatureResponse, error) {
+	return c.send(r, &SignatureRequest{
+		Roster:  r,
+		Message: msg,
+		Data:    data,
+	})
+}
+
+// SignatureRequestStream sends a CoSi sign request to the first node of the
+// Roster that can be reached, as SignatureRequest does, and returns a channel
+// that receives the progress of the session. The last event holds the final
+// response or an error, and the channel is closed after it. Closing done
+// stops the stream if the caller doesn't read it until the end.
+func (c *Client) SignatureRequestStream(r *onet.Roster, msg []byte, done <-chan struct{}) (<-chan *SignatureProgress, error) {
 	if len(r.List) == 0 {
 		return nil, errors.New("Got an empty roster-list")
 	}
-	dst := r.List[0]
-	log.Lvl4("Sending message to", dst)
+	req := &SignatureStreamRequest{
+		Request: &SignatureRequest{Roster: r, Message: msg},
+	}
+
+	var err error
+	for _, dst := range r.List {
+		log.Lvl4("Streaming message to", dst)
+		conn, errStream := c.Stream(dst, req)
+		if errStream != nil {
+			err = errStream
+			if c.reachable(dst) {
+				return nil, &ServiceError{Node: dst, Err: err}
+			}
+			log.Lvl2("Signature stream to", dst, "failed:", err)
+			continue
+		}
+
+		// The connection is closed once the stream ends or is stopped,
+		// which also interrupts a pending read
+		finished := make(chan struct{})
+		go func() {
+			select {
+			case <-done:
+			case <-finished:
+			}
+			conn.Close()
+		}()
+
+		events := make(chan *SignatureProgress, progressBuffer)
+		go func() {
+			defer close(events)
+			defer close(finished)
+			for {
+				event := &SignatureProgress{}
+				if err := conn.ReadMessage(event); err != nil {
+					event = &SignatureProgress{Error: err.Error()}
+				}
+				select {
+				case events <- event:
+				case <-done:
+					return
+				}
+				if event.Final != nil || event.Error != "" {
+					return
+				}
+			}
+		}()
+		return events, nil
+	}
+	return nil, err
+}
+
+// Result asks the node for the final signature of the request that it
+// knows, which exists if it took part in a session of the request that
+// completed. The signature is only returned if it fulfills the request.
+func (c *Client) Result(dst *network.ServerIdentity, req *SignatureRequest) (*SignatureResponse, error) {
 	reply := &SignatureResponse{}
-	err := c.SendProtobuf(dst, serviceReq, reply)
+	err := c.SendProtobuf(dst, &ResultRequest{
+		Hash:     c.hash(req.Message),
+		RosterID: req.Roster.ID,
+		DataHash: c.hash(req.Data),
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkResult(req, reply); err != nil {
+		return nil, err
+	}
+	return checkStatus(reply)
+}
+
+func (c *Client) hash(data []byte) []byte {
+	h := c.suite.Hash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// checkResult returns an error if the reply isn't a signature of the
+// message by the roster of the request, with the policy of the request.
+// The threshold is only checked when the request sets the policy, the
+// threshold of the service is used otherwise.
+func (c *Client) checkResult(req *SignatureRequest, reply *SignatureResponse) error {
+	n := len(req.Roster.List)
+	if !bytes.Equal(reply.Hash, c.hash(req.Message)) {
+		return errors.New("signature of another message")
+	}
+	if !equalInts(reply.Weights, req.Weights) {
+		return errors.New("signature with other weights")
+	}
+	if !reflect.DeepEqual(normalizeGroups(reply.Groups), normalizeGroups(req.Groups)) {
+		return errors.New("signature with other groups")
+	}
+	if len(req.Weights) > 0 || req.Policy != (protocol.Policy{}) {
+		threshold, err := req.Policy.Threshold(protocol.TotalWeight(req.Weights, n))
+		if err != nil {
+			return err
+		}
+		if reply.Threshold != threshold {
+			return fmt.Errorf("signature with a threshold of %d instead of %d", reply.Threshold, threshold)
+		}
+	}
+	if (reply.Context != nil) != req.Params.BindSession {
+		return errors.New("signature not bound as requested")
+	}
+	if reply.Context != nil && reply.Context.RosterID != req.Roster.ID {
+		return errors.New("signature bound to another roster")
+	}
+	return nil
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeGroups returns nil for no group, as the decoding does.
+func normalizeGroups(groups []protocol.Group) []protocol.Group {
+	if len(groups) == 0 {
+		return nil
+	}
+	return groups
+}
+
+// checkStatus returns an error when the signature of the reply is partial.
+func checkStatus(reply *SignatureResponse) (*SignatureResponse, error) {
+	if reply.Status == StatusBelowThreshold {
+		return nil, &PartialSignatureError{reply}
+	}
+	return reply, nil
+}
 
-	return reply, err
+// send sends the request to the first node of the roster. If it can't be
+// reached, the other nodes are tried in turn: a node first returns the
+// signature if it finalized the session of a failed root, and is asked to
+// lead a new session otherwise. When the node can still be reached after
+// the failure, the request was rejected by its service, and a ServiceError
+// is returned since every node would reject it.
+func (c *Client) send(r *onet.Roster, serviceReq *SignatureRequest) (*SignatureResponse, error) {
+	if len(r.List) == 0 {
+		return nil, errors.New("Got an empty roster-list")
+	}
+
+	var err error
+	for i, dst := range r.List {
+		if i > 0 {
+			reply, errResult := c.Result(dst, serviceReq)
+			if errResult == nil {
+				return reply, nil
+			}
+		}
+
+		log.Lvl4("Sending message to", dst)
+		reply := &SignatureResponse{}
+		err = c.SendProtobuf(dst, serviceReq, reply)
+		if err == nil {
+			return checkStatus(reply)
+		}
+		if c.reachable(dst) {
+			return nil, &ServiceError{Node: dst, Err: err}
+		}
+		log.Lvl2("Signature request to", dst, "failed:", err)
+	}
+	return nil, err
+}
+
+// reachable returns true if the service of the node answers.
+func (c *Client) reachable(dst *network.ServerIdentity) bool {
+	return c.SendProtobuf(dst, &PingRequest{}, &PingResponse{}) == nil
+}
+
+// Container returns the self-describing form of the response made by the
+// given roster with the given suite, to be archived.
+func (r *SignatureResponse) Container(suite pairing.Suite, ro *onet.Roster) (*protocol.SignatureContainer, error) {
+	n := len(ro.List)
+	c, err := protocol.NewSignatureContainer(suite, r.Signature, ro.ID, n)
+	if err != nil {
+		return nil, err
+	}
+	c.Threshold = r.Threshold
+	if c.Threshold == 0 {
+		c.Threshold = protocol.DefaultThreshold(protocol.TotalWeight(r.Weights, n))
+	}
+	c.Weights = r.Weights
+	c.Groups = r.Groups
+	c.Refusal = r.Refusal
+	c.Context = r.Context
+	return c, nil
 }
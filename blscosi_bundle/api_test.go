@@ -10,8 +10,9 @@ import (
 
 func TestClient_SignatureRequest(t *testing.T) {
 	local := onet.NewTCPTest(testSuite)
-	_, roster, _ := local.GenTree(10, false)
+	hosts, roster, _ := local.GenTree(10, false)
 	defer local.CloseAll()
+	acceptAll(t, hosts)
 
 	// Send a request to the service to all hosts
 	client := NewClient()
@@ -29,6 +30,36 @@ func TestClient_SignatureRequest(t *testing.T) {
 		publics := newRoster.ServicePublics(ServiceName)
 
 		// verify the response still
-		require.Nil(t, reply.Signature.Verify(testSuite, msg, publics))
+		require.Nil(t, reply.Signature.VerifyAggregate(testSuite, msg, publics))
 	}
 }
+
+func TestClient_Retry(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	client := NewClient()
+	msg := []byte("hello blscosi_bundle retry")
+
+	// The verification is only known by the second node: the first one
+	// rejects the request, which isn't sent to the others
+	service := hosts[1].Service(ServiceName).(*Service)
+	require.NoError(t, service.RegisterVerification("secondOnly", func(msg, data []byte) bool {
+		return true
+	}))
+	_, err := client.SendSignatureRequest(&SignatureRequest{
+		Roster:       roster,
+		Message:      msg,
+		Verification: "secondOnly",
+	})
+	require.IsType(t, &ServiceError{}, err)
+	require.True(t, err.(*ServiceError).Node.Equal(roster.List[0]))
+
+	// The first node can't be reached, the request is sent to the next one
+	acceptAll(t, hosts)
+	hosts[0].Close()
+	reply, err := client.SignatureRequest(roster, msg)
+	require.NoError(t, err)
+	require.NoError(t, reply.Signature.VerifyAggregate(testSuite, msg, roster.ServicePublics(ServiceName)))
+}
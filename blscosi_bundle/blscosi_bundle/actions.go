@@ -10,8 +10,12 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/BurntSushi/toml"
 	"github.com/dedis/student_19_gossip_bls/blscosi_bundle"
 	"github.com/dedis/student_19_gossip_bls/blscosi_bundle/blscosi_bundle/check"
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle/protocol"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/log"
 	cli "gopkg.in/urfave/cli.v1"
@@ -20,6 +24,19 @@ import (
 type sigHex struct {
 	Hash      string
 	Signature string
+	Refusal   bool             `json:",omitempty"`
+	Threshold int              `json:",omitempty"`
+	Groups    []protocol.Group `json:",omitempty"`
+	Container string           `json:",omitempty"`
+}
+
+// weightedGroup is the part of the group file read for the weights of the
+// servers
+type weightedGroup struct {
+	Servers []struct {
+		Address string
+		Weight  *int
+	}
 }
 
 // check contacts all servers and verifies if it receives a valid
@@ -44,10 +61,13 @@ func signFile(c *cli.Context) error {
 		return errors.New("Couldn't read file to be signed:" + err.Error())
 	}
 
-	sig, err := sign(msg, groupToml)
+	sig, roster, suite, err := sign(msg, groupToml, c.String("suite"), c.Int("organisations"), c.Bool("bind"))
 	if err != nil {
 		return fmt.Errorf("Couldn't create signature: %s", err.Error())
 	}
+	if sig.Refusal {
+		log.Warn("The cothority refused to sign, writing the refusal certificate instead")
+	}
 
 	var outFile *os.File
 	outFileName := c.String("out")
@@ -60,7 +80,7 @@ func signFile(c *cli.Context) error {
 		outFile = os.Stdout
 	}
 
-	err = writeSigAsJSON(sig, outFile)
+	err = writeSigAsJSON(sig, roster, suite, outFile)
 	if err != nil {
 		return err
 	}
@@ -77,20 +97,41 @@ func verifyFile(c *cli.Context) error {
 	}
 
 	sigOrEmpty := c.String("signature")
-	err := verify(c.Args().First(), sigOrEmpty, c.String(optionGroup))
+	refusal := c.Bool("refusal")
+	required := check.Policy{Threshold: c.Int("threshold")}
+	err := verify(c.Args().First(), sigOrEmpty, c.String(optionGroup), refusal, c.Int("organisations"), required)
 	if err != nil {
 		return fmt.Errorf("Invalid: Signature verification failed: %s", err.Error())
 	}
 
-	fmt.Fprintln(c.App.Writer, "[+] OK: Signature is valid.")
+	if refusal {
+		fmt.Fprintln(c.App.Writer, "[+] OK: Refusal certificate is valid.")
+	} else {
+		fmt.Fprintln(c.App.Writer, "[+] OK: Signature is valid.")
+	}
 	return nil
 }
 
-// writeSigAsJSON - writes the JSON out to a file
-func writeSigAsJSON(res *blscosi_bundle.SignatureResponse, outW io.Writer) error {
+// writeSigAsJSON - writes the JSON out to a file. Besides the fields read
+// by the previous versions, it holds the versioned signature container made
+// with the pairing suite of the signature.
+func writeSigAsJSON(res *blscosi_bundle.SignatureResponse, ro *onet.Roster, suite pairing.Suite, outW io.Writer) error {
+	container, err := res.Container(suite, ro)
+	if err != nil {
+		return fmt.Errorf("Couldn't make signature container: %s", err.Error())
+	}
+	data, err := container.Marshal()
+	if err != nil {
+		return fmt.Errorf("Couldn't encode signature container: %s", err.Error())
+	}
+
 	b, err := json.Marshal(sigHex{
 		Hash:      hex.EncodeToString(res.Hash),
-		Signature: hex.EncodeToString(res.Signature)},
+		Signature: hex.EncodeToString(res.Signature),
+		Refusal:   res.Refusal,
+		Threshold: res.Threshold,
+		Groups:    res.Groups,
+		Container: hex.EncodeToString(data)},
 	)
 
 	if err != nil {
@@ -112,29 +153,103 @@ func writeSigAsJSON(res *blscosi_bundle.SignatureResponse, outW io.Writer) error
 	return err
 }
 
-// sign takes a byte slice and a toml file defining the servers
-func sign(msg []byte, tomlFileName string) (*blscosi_bundle.SignatureResponse, error) {
+// sign takes a byte slice and a toml file defining the servers. When
+// perOrganisation is positive, that many servers of each organisation, as
+// given by the descriptions of the servers, must sign. When bind is true,
+// the signature is bound to the roster and the session. The signature is
+// made by the service registered with the pairing suite of the given name.
+// The roster of the group and the suite are returned with the signature.
+func sign(msg []byte, tomlFileName string, suiteName string, perOrganisation int, bind bool) (*blscosi_bundle.SignatureResponse, *onet.Roster, pairing.Suite, error) {
 	log.Lvl2("Starting signature")
+	serviceName, suite, err := blscosi_bundle.FindService(suiteName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	client, err := blscosi_bundle.NewClientWithSuite(serviceName, suite)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	f, err := os.Open(tomlFileName)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	g, err := app.ReadGroupDescToml(f)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	if len(g.Roster.List) <= 0 {
-		return nil, fmt.Errorf("Empty or invalid blscosi group file: %s", tomlFileName)
+		return nil, nil, nil, fmt.Errorf("Empty or invalid blscosi group file: %s", tomlFileName)
+	}
+
+	weights, err := readWeights(tomlFileName, g.Roster)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var groups []protocol.Group
+	if perOrganisation > 0 {
+		groups = protocol.GroupsByDescription(g.Roster, perOrganisation)
 	}
 
 	log.Lvl2("Sending signature to", g.Roster)
-	return check.SignStatement(msg, g.Roster)
+	req := &blscosi_bundle.SignatureRequest{
+		Roster:  g.Roster,
+		Message: msg,
+		Weights: weights,
+		Groups:  groups,
+	}
+	if bind {
+		req.Params = protocol.DefaultParams()
+		req.Params.BindSession = true
+	}
+	sig, err := check.SignStatementWithClient(client, req)
+	return sig, g.Roster, suite, err
+}
+
+// readWeights returns the weights of the servers of the roster given by the
+// optional Weight field of the group file, in the order of the roster.
+// Servers without a weight weigh one, and nil is returned when no server
+// has a weight.
+func readWeights(tomlFileName string, ro *onet.Roster) ([]int, error) {
+	group := &weightedGroup{}
+	if _, err := toml.DecodeFile(tomlFileName, group); err != nil {
+		return nil, err
+	}
+
+	byAddress := make(map[string]int)
+	for _, s := range group.Servers {
+		if s.Weight == nil {
+			continue
+		}
+		if *s.Weight < 0 {
+			return nil, fmt.Errorf("Negative weight for server %s", s.Address)
+		}
+		byAddress[s.Address] = *s.Weight
+	}
+	if len(byAddress) == 0 {
+		return nil, nil
+	}
+
+	weights := make([]int, len(ro.List))
+	for i, si := range ro.List {
+		w, ok := byAddress[si.Address.String()]
+		if !ok {
+			w = 1
+		}
+		weights[i] = w
+	}
+	return weights, nil
 }
 
 // verify takes a file and a group-definition, calls the signature
 // verification and prints the result. If sigFileName is empty it
-// assumes to find the standard signature in fileName.sig
-func verify(fileName, sigFileName, groupToml string) error {
+// assumes to find the standard signature in fileName.sig. If refusal is
+// true, the signature must be a collective refusal certificate. When
+// perOrganisation is positive, that many servers of each organisation must
+// have signed, as for sign. The signature must fulfil the required policy,
+// whatever the signature file claims.
+func verify(fileName, sigFileName, groupToml string, refusal bool, perOrganisation int, required check.Policy) error {
 	// if the file hash matches the one in the signature
 	log.Lvl4("Reading file " + fileName)
 	b, err := ioutil.ReadFile(fileName)
@@ -161,26 +276,58 @@ func verify(fileName, sigFileName, groupToml string) error {
 		return err
 	}
 
-	sig := &blscosi_bundle.SignatureResponse{}
-	sig.Hash, err = hex.DecodeString(sigStr.Hash)
+	fGroup, err := os.Open(groupToml)
 	if err != nil {
 		return err
 	}
-	sig.Signature, err = hex.DecodeString(sigStr.Signature)
+
+	log.Lvl4("Reading group definition")
+	g, err := app.ReadGroupDescToml(fGroup)
 	if err != nil {
 		return err
 	}
-	fGroup, err := os.Open(groupToml)
+
+	// The weights and the groups are the ones of the group file, whatever
+	// the signature claims
+	required.Weights, err = readWeights(groupToml, g.Roster)
 	if err != nil {
 		return err
 	}
+	if perOrganisation > 0 {
+		required.Groups = protocol.GroupsByDescription(g.Roster, perOrganisation)
+	}
 
-	log.Lvl4("Reading group definition")
-	g, err := app.ReadGroupDescToml(fGroup)
+	if sigStr.Container != "" {
+		data, err := hex.DecodeString(sigStr.Container)
+		if err != nil {
+			return err
+		}
+		container, err := protocol.UnmarshalSignatureContainer(data)
+		if err != nil {
+			return err
+		}
+		log.Lvlf4("Verifying signature container %x %x", b, container.Signature)
+		return check.VerifyContainer(b, container, g.Roster, refusal, required)
+	}
+
+	// Signatures written before the containers only have the raw form
+	sig := &blscosi_bundle.SignatureResponse{
+		Refusal:   sigStr.Refusal,
+		Threshold: sigStr.Threshold,
+		Groups:    sigStr.Groups,
+	}
+	sig.Hash, err = hex.DecodeString(sigStr.Hash)
+	if err != nil {
+		return err
+	}
+	sig.Signature, err = hex.DecodeString(sigStr.Signature)
 	if err != nil {
 		return err
 	}
 
 	log.Lvlf4("Verifying signature %x %x", b, sig.Signature)
-	return check.VerifySignatureHash(b, sig, g.Roster)
+	if refusal {
+		return check.VerifyRefusalHashWithPolicy(b, sig, g.Roster, required)
+	}
+	return check.VerifySignatureHashWithPolicy(b, sig, g.Roster, required)
 }
@@ -6,6 +6,7 @@ import (
 	"path"
 	"testing"
 
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/onet/v3"
@@ -14,6 +15,14 @@ import (
 
 var testSuite = pairing.NewSuiteBn256()
 
+// The servers of the tests sign every message, as with --accept-all
+func init() {
+	err := blscosi_bundle.GlobalRegisterVerification(blscosi_bundle.DefaultVerification, acceptAll)
+	if err != nil {
+		panic(err)
+	}
+}
+
 // TestMain_Check checks if the CLI command check works correctly
 func TestMain_Check(t *testing.T) {
 	tmp, _ := ioutil.TempDir("", "")
@@ -69,6 +78,10 @@ func TestMain_Sign(t *testing.T) {
 	err = cliApp.Run([]string{"", "sign", "-g", publicToml, publicToml})
 	require.NoError(t, err)
 
+	// no service signs with the suite
+	err = cliApp.Run([]string{"", "sign", "-g", publicToml, "--suite", "ed25519", publicToml})
+	require.Error(t, err)
+
 	// file output
 	err = cliApp.Run([]string{"", "sign", "-g", publicToml, "-o", signatureFile, publicToml})
 	require.NoError(t, err)
@@ -7,6 +7,8 @@ import (
 	"os"
 	"path"
 
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle"
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle/protocol"
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/cfgpath"
@@ -61,6 +63,10 @@ func createApp() *cli.App {
 			Value: path.Join(cfgpath.GetConfigPath(BinaryName), app.DefaultServerConfig),
 			Usage: "Configuration file of the server",
 		},
+		cli.BoolFlag{
+			Name:  "accept-all",
+			Usage: "Sign every message of the requests that name no verification function",
+		},
 	}
 	cliApp.Commands = []cli.Command{
 		// BEGIN CLIENT ----------
@@ -75,6 +81,19 @@ func createApp() *cli.App {
 					Name:  "out, o",
 					Usage: "Write signature to 'file.sig' instead of STDOUT",
 				},
+				cli.IntFlag{
+					Name:  "organisations, k",
+					Usage: "Require 'k' signers from each organisation, given by the descriptions of the servers",
+				},
+				cli.BoolFlag{
+					Name:  "bind, b",
+					Usage: "Bind the signature to the roster and the session, it can only be verified with the signature container",
+				},
+				cli.StringFlag{
+					Name:  "suite",
+					Value: protocol.SuiteName(blscosi_bundle.Suite()),
+					Usage: "Sign with the service registered with the pairing 'suite'",
+				},
 			}...),
 		},
 		{
@@ -88,6 +107,18 @@ func createApp() *cli.App {
 					Name:  "signature, s",
 					Usage: "Read signature from 'file.sig' instead of STDIN",
 				},
+				cli.BoolFlag{
+					Name:  "refusal, r",
+					Usage: "Verify a collective refusal certificate instead of a signature",
+				},
+				cli.IntFlag{
+					Name:  "threshold, t",
+					Usage: "Require signers weighing at least 't' instead of the default threshold of the group",
+				},
+				cli.IntFlag{
+					Name:  "organisations, k",
+					Usage: "Require 'k' signers from each organisation, given by the descriptions of the servers",
+				},
 			}...),
 		},
 		{
@@ -144,6 +175,16 @@ func createApp() *cli.App {
 
 func runServer(ctx *cli.Context) {
 	config := ctx.String("config")
+	if ctx.Bool("accept-all") {
+		err := blscosi_bundle.GlobalRegisterVerification(blscosi_bundle.DefaultVerification, acceptAll)
+		log.ErrFatal(err)
+	}
 
 	app.RunServer(config)
 }
+
+// acceptAll is the verification function of the servers signing every
+// message
+func acceptAll(msg, data []byte) bool {
+	return true
+}
@@ -11,7 +11,9 @@ import (
 	"time"
 
 	"github.com/dedis/student_19_gossip_bls/blscosi_bundle"
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle/protocol"
 	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/log"
@@ -22,6 +24,21 @@ import (
 // reply
 const RequestTimeOut = time.Second * 10
 
+// Policy is what the verifier requires from a signature. It is chosen by the
+// verifier and never read from the signature, whose threshold can only make
+// the policy stricter.
+type Policy struct {
+	// Threshold is the minimal number of signers, or their minimal weight
+	// when Weights is set. The default threshold of the roster is used when
+	// it is zero
+	Threshold int
+	// Weights is the weight of each node, in the order of the roster. Every
+	// node weighs one when it is nil
+	Weights []int
+	// Groups must each have enough signers
+	Groups []protocol.Group
+}
+
 // CothorityCheck contacts all servers in the entity-list and then makes checks
 // on each pair. If server-descriptions are available, it will print them
 // along with the IP-address of the server.
@@ -134,8 +151,32 @@ func checkRoster(ro *onet.Roster, descs []string, detail bool) error {
 
 // SignStatement can be used to sign the contents passed in the io.Reader
 func SignStatement(msg []byte, ro *onet.Roster) (*blscosi_bundle.SignatureResponse, error) {
-	client := blscosi_bundle.NewClient()
-	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
+	return SignStatementWithPolicy(msg, ro, nil, nil)
+}
+
+// SignStatementWithPolicy signs the contents with a threshold on the sum of
+// the weights of the nodes of the roster, and enough signers in each of the
+// groups. Both are optional.
+func SignStatementWithPolicy(msg []byte, ro *onet.Roster, weights []int, groups []protocol.Group) (*blscosi_bundle.SignatureResponse, error) {
+	return SignStatementWithRequest(&blscosi_bundle.SignatureRequest{
+		Roster:  ro,
+		Message: msg,
+		Weights: weights,
+		Groups:  groups,
+	})
+}
+
+// SignStatementWithRequest signs the message of the request with all the
+// options of the request
+func SignStatementWithRequest(req *blscosi_bundle.SignatureRequest) (*blscosi_bundle.SignatureResponse, error) {
+	return SignStatementWithClient(blscosi_bundle.NewClient(), req)
+}
+
+// SignStatementWithClient signs the message of the request with the service
+// and the pairing suite of the client
+func SignStatementWithClient(client *blscosi_bundle.Client, req *blscosi_bundle.SignatureRequest) (*blscosi_bundle.SignatureResponse, error) {
+	msg := req.Message
+	publics := req.Roster.ServicePublics(client.ServiceName())
 
 	log.Lvlf4("Signing message %x", msg)
 
@@ -143,7 +184,7 @@ func SignStatement(msg []byte, ro *onet.Roster) (*blscosi_bundle.SignatureRespon
 	echan := make(chan error, 1)
 	go func() {
 		log.Lvl3("Waiting for the response on SignRequest")
-		response, err := client.SignatureRequest(ro, msg[:])
+		response, err := client.SendSignatureRequest(req)
 		if err != nil {
 			echan <- err
 			return
@@ -157,7 +198,25 @@ func SignStatement(msg []byte, ro *onet.Roster) (*blscosi_bundle.SignatureRespon
 	case response := <-pchan:
 		log.Lvlf5("Response: %x", response.Signature)
 
-		err := response.Signature.VerifyAggregate(client.Suite().(*pairing.SuiteBn256), msg[:], publics)
+		// The response must fulfil the policy of the request
+		required := Policy{Weights: req.Weights, Groups: req.Groups}
+		if req.Policy != (protocol.Policy{}) {
+			threshold, err := req.Policy.Threshold(protocol.TotalWeight(req.Weights, len(publics)))
+			if err != nil {
+				return nil, err
+			}
+			required.Threshold = threshold
+		}
+
+		suite := client.PairingSuite()
+		var err error
+		if response.Refusal {
+			policy := refusalPolicy(required, len(publics))
+			err = response.Signature.VerifyRefusalWithPolicy(suite, signedMessage(suite, response, msg), publics, policy)
+		} else {
+			policy := signaturePolicy(response, required, len(publics))
+			err = response.Signature.VerifyAggregateWithPolicy(suite, signedMessage(suite, response, msg), publics, policy)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -167,11 +226,137 @@ func SignStatement(msg []byte, ro *onet.Roster) (*blscosi_bundle.SignatureRespon
 	}
 }
 
-// VerifySignatureHash checks that the signature is correct
+// VerifySignatureHash checks that the signature is correct, with the default
+// threshold of the roster
 func VerifySignatureHash(b []byte, sig *blscosi_bundle.SignatureResponse, ro *onet.Roster) error {
-	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
+	return VerifySignatureHashWithPolicy(b, sig, ro, Policy{})
+}
+
+// VerifySignatureHashWithPolicy checks that the signature is correct and
+// fulfils the policy
+func VerifySignatureHashWithPolicy(b []byte, sig *blscosi_bundle.SignatureResponse, ro *onet.Roster, required Policy) error {
+	suite := blscosi_bundle.Suite()
 	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
 
+	if sig.Refusal {
+		return errors.New("the signature is a refusal certificate")
+	}
+	if err := checkHash(suite, b, sig); err != nil {
+		return err
+	}
+	if sig.Context != nil && sig.Context.RosterID != ro.ID {
+		return errors.New("the signature is bound to another roster")
+	}
+
+	policy := signaturePolicy(sig, required, len(publics))
+	if err := sig.Signature.VerifyAggregateWithPolicy(suite, signedMessage(suite, sig, b), publics, policy); err != nil {
+		return errors.New("Invalid sig:" + err.Error())
+	}
+	return nil
+}
+
+// VerifyRefusalHash checks that the refusal certificate is correct, with
+// the default threshold of the roster
+func VerifyRefusalHash(b []byte, sig *blscosi_bundle.SignatureResponse, ro *onet.Roster) error {
+	return VerifyRefusalHashWithPolicy(b, sig, ro, Policy{})
+}
+
+// VerifyRefusalHashWithPolicy checks that the refusal certificate is correct
+// and makes the policy unreachable
+func VerifyRefusalHashWithPolicy(b []byte, sig *blscosi_bundle.SignatureResponse, ro *onet.Roster, required Policy) error {
+	suite := blscosi_bundle.Suite()
+	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
+
+	if !sig.Refusal {
+		return errors.New("the signature is not a refusal certificate")
+	}
+	if err := checkHash(suite, b, sig); err != nil {
+		return err
+	}
+	if sig.Context != nil && sig.Context.RosterID != ro.ID {
+		return errors.New("the signature is bound to another roster")
+	}
+
+	policy := refusalPolicy(required, len(publics))
+	if err := sig.Signature.VerifyRefusalWithPolicy(suite, signedMessage(suite, sig, b), publics, policy); err != nil {
+		return errors.New("Invalid refusal:" + err.Error())
+	}
+	return nil
+}
+
+// VerifyContainer checks that the container holds a correct signature of
+// the content by the roster, or a correct refusal certificate if refusal is
+// true, for the required policy
+func VerifyContainer(b []byte, c *protocol.SignatureContainer, ro *onet.Roster, refusal bool, required Policy) error {
+	// The container names its suite, and the keys are the ones of the
+	// service registered with that suite
+	serviceName, suite, err := blscosi_bundle.FindService(c.Suite)
+	if err != nil {
+		return err
+	}
+	publics := ro.ServicePublics(serviceName)
+
+	if c.Refusal && !refusal {
+		return errors.New("the signature is a refusal certificate")
+	}
+	if !c.Refusal && refusal {
+		return errors.New("the signature is not a refusal certificate")
+	}
+	policy := protocol.RequiredPolicy{
+		Threshold: required.Threshold,
+		Weights:   required.Weights,
+		Groups:    required.Groups,
+	}
+	if err := c.Verify(suite, b, ro.ID, publics, policy); err != nil {
+		return errors.New("Invalid sig:" + err.Error())
+	}
+	return nil
+}
+
+// signedMessage returns what the nodes signed for the content: the content
+// itself, or its digest bound to the context of the response
+func signedMessage(suite pairing.Suite, sig *blscosi_bundle.SignatureResponse, b []byte) []byte {
+	if sig.Context == nil {
+		return b
+	}
+	return sig.Context.Statement(suite, b)
+}
+
+// threshold returns the threshold required by the verifier among n nodes,
+// or the default one
+func (p Policy) threshold(n int) int {
+	if p.Threshold > 0 {
+		return p.Threshold
+	}
+	return protocol.DefaultThreshold(protocol.TotalWeight(p.Weights, n))
+}
+
+// signaturePolicy returns the policy that the signature of the response
+// must fulfil, among n nodes. The threshold of the response is only used if
+// it is higher than the required one, and its weights are never used. Its
+// groups are only required on top of the required ones.
+func signaturePolicy(sig *blscosi_bundle.SignatureResponse, required Policy, n int) sign.Policy {
+	threshold := required.threshold(n)
+	if sig.Threshold > threshold {
+		threshold = sig.Threshold
+	}
+	return protocol.AllPolicies{
+		protocol.NewWeightedPolicy(required.Weights, threshold),
+		protocol.NewGroupPolicy(required.Groups),
+		protocol.NewGroupPolicy(sig.Groups),
+	}
+}
+
+// refusalPolicy returns the policy that the refusal certificate of the
+// response must fulfil, among n nodes: the refusers must be a quorum for the
+// required threshold, and make it or one of the groups unreachable. The
+// threshold, the weights and the groups of the response are not used.
+func refusalPolicy(required Policy, n int) sign.Policy {
+	return protocol.NewRefusalPolicy(required.Weights, required.threshold(n), required.Groups)
+}
+
+// checkHash checks that the signature belongs to the given content
+func checkHash(suite pairing.Suite, b []byte, sig *blscosi_bundle.SignatureResponse) error {
 	h := suite.Hash()
 	_, err := h.Write(b)
 	if err != nil {
@@ -184,9 +369,5 @@ func VerifySignatureHash(b []byte, sig *blscosi_bundle.SignatureResponse, ro *on
 			"belonging to another file. (The hash provided by the signature " +
 			"doesn't match with the hash of the file.)")
 	}
-
-	if err := sig.Signature.VerifyAggregate(suite, b, publics); err != nil {
-		return errors.New("Invalid sig:" + err.Error())
-	}
 	return nil
 }
@@ -6,6 +6,8 @@ import (
 	"path"
 	"testing"
 
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle"
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle/protocol"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/onet/v3"
@@ -15,6 +17,31 @@ import (
 
 var testSuite = pairing.NewSuiteBn256()
 
+// otherSuite is the bn256 adapter under another name, for a second service
+type otherSuite struct {
+	*pairing.SuiteBn256
+}
+
+func (s otherSuite) String() string {
+	return "bn256.other"
+}
+
+const otherServiceName = "blsCoSiOtherService"
+
+func init() {
+	_, err := blscosi_bundle.RegisterService(otherServiceName, otherSuite{pairing.NewSuiteBn256()})
+	if err != nil {
+		panic(err)
+	}
+	// The servers of the tests sign every message
+	err = blscosi_bundle.GlobalRegisterVerification(blscosi_bundle.DefaultVerification, func(msg, data []byte) bool {
+		return true
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
 // TestMain_Check checks if the CLI command check works correctly
 func TestCheck(t *testing.T) {
 	tmp, _ := ioutil.TempDir("", "")
@@ -58,3 +85,102 @@ func TestCheck(t *testing.T) {
 	err = CothorityCheck(publicToml, false)
 	require.Error(t, err)
 }
+
+func TestVerifySignatureHash_Threshold(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	hosts, roster, _ := local.GenTree(5, true)
+
+	// Only the root signs, with a threshold of one
+	for i, host := range hosts {
+		accept := i == 0
+		service := host.Service(blscosi_bundle.ServiceName).(*blscosi_bundle.Service)
+		require.NoError(t, service.RegisterVerification("rootOnly", func(msg, data []byte) bool {
+			return accept
+		}))
+	}
+	msg := []byte("hello threshold")
+	buf, err := hosts[0].Service(blscosi_bundle.ServiceName).(*blscosi_bundle.Service).SignatureRequest(
+		&blscosi_bundle.SignatureRequest{
+			Roster:       roster,
+			Message:      msg,
+			Verification: "rootOnly",
+			Policy:       protocol.Policy{Model: protocol.ExplicitQuorum, K: 1},
+		})
+	require.NoError(t, err)
+	sig := buf.(*blscosi_bundle.SignatureResponse)
+	require.Equal(t, 1, sig.Signers)
+	require.Equal(t, 1, sig.Threshold)
+
+	// The threshold written in the container doesn't lower the one of the
+	// verifier either
+	c, err := sig.Container(blscosi_bundle.Suite(), roster)
+	require.NoError(t, err)
+	require.Error(t, VerifyContainer(msg, c, roster, false, Policy{}))
+	require.NoError(t, VerifyContainer(msg, c, roster, false, Policy{Threshold: 1}))
+
+	// The threshold written in the signature doesn't lower the one of the
+	// verifier
+	require.Error(t, VerifySignatureHash(msg, sig, roster))
+	sig.Threshold = 0
+	require.Error(t, VerifySignatureHash(msg, sig, roster))
+	require.NoError(t, VerifySignatureHashWithPolicy(msg, sig, roster, Policy{Threshold: 1}))
+
+	// but it can raise it
+	sig.Threshold = 2
+	require.Error(t, VerifySignatureHashWithPolicy(msg, sig, roster, Policy{Threshold: 1}))
+
+	// The weights are the ones of the verifier too
+	sig.Threshold = 0
+	sig.Weights = []int{4, 0, 0, 0, 0}
+	require.Error(t, VerifySignatureHash(msg, sig, roster))
+	weights := []int{4, 1, 1, 1, 1}
+	require.Error(t, VerifySignatureHashWithPolicy(msg, sig, roster, Policy{Weights: weights}))
+	require.NoError(t, VerifySignatureHashWithPolicy(msg, sig, roster, Policy{Threshold: 4, Weights: weights}))
+
+	// And so are the groups, the ones of the signature can only add
+	// constraints
+	sig.Weights = nil
+	sig.Groups = []protocol.Group{{Name: "root", Members: []uint32{0}, K: 1}}
+	require.NoError(t, VerifySignatureHashWithPolicy(msg, sig, roster, Policy{Threshold: 1}))
+	groups := []protocol.Group{{Name: "others", Members: []uint32{1, 2}, K: 1}}
+	require.Error(t, VerifySignatureHashWithPolicy(msg, sig, roster, Policy{Threshold: 1, Groups: groups}))
+	sig.Groups = []protocol.Group{{Name: "others", Members: []uint32{1, 2}, K: 1}}
+	require.Error(t, VerifySignatureHashWithPolicy(msg, sig, roster, Policy{Threshold: 1}))
+}
+
+func TestVerifyContainer_Suite(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(3, true)
+
+	// The suite is taken by the other service already
+	_, err := blscosi_bundle.RegisterService("blsCoSiThirdService", otherSuite{pairing.NewSuiteBn256()})
+	require.Error(t, err)
+
+	serviceName, suite, err := blscosi_bundle.FindService("bn256.other")
+	require.NoError(t, err)
+	require.Equal(t, otherServiceName, serviceName)
+	client, err := blscosi_bundle.NewClientWithSuite(serviceName, suite)
+	require.NoError(t, err)
+
+	msg := []byte("hello other suite")
+	sig, err := SignStatementWithClient(client, &blscosi_bundle.SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.NoError(t, err)
+
+	// The container is verified with the keys of the service of its suite
+	c, err := sig.Container(suite, roster)
+	require.NoError(t, err)
+	require.Equal(t, "bn256.other", c.Suite)
+	require.NoError(t, VerifyContainer(msg, c, roster, false, Policy{}))
+
+	// and not with the keys of the default service
+	c.Suite = protocol.SuiteName(blscosi_bundle.Suite())
+	require.Error(t, VerifyContainer(msg, c, roster, false, Policy{}))
+
+	c.Suite = "unknown"
+	require.Error(t, VerifyContainer(msg, c, roster, false, Policy{}))
+}
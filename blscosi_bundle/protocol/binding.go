@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/onet/v3"
+)
+
+// bindingPrefix separates the statements bound to a session from the other
+// statements signed with the same keys.
+const bindingPrefix = "bundleCoSi bound:"
+
+// SigningContext is the context that a signature is bound to, when the
+// session is run with BindSession: the nodes sign a digest of the context
+// and the message instead of the message, so that the signature is only
+// valid for the protocol, the roster and the session that made it.
+type SigningContext struct {
+	Protocol string
+	RosterID onet.RosterID
+	Nonce    []byte
+}
+
+// Statement returns the digest of the context and the message, which is
+// what the nodes sign.
+func (ctx *SigningContext) Statement(suite pairing.Suite, msg []byte) []byte {
+	h := suite.Hash()
+	h.Write([]byte(bindingPrefix))
+	binary.Write(h, binary.BigEndian, uint32(len(ctx.Protocol)))
+	h.Write([]byte(ctx.Protocol))
+	h.Write(ctx.RosterID[:])
+	binary.Write(h, binary.BigEndian, uint32(len(ctx.Nonce)))
+	h.Write(ctx.Nonce)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// VerifyAggregateInContext checks the signature over the message, bound to
+// the given context, using the public keys and the policy.
+func (sig BlsSignature) VerifyAggregateInContext(suite pairing.Suite, ctx *SigningContext, msg []byte, publics []kyber.Point, policy sign.Policy) error {
+	if msg == nil {
+		return errors.New("no message provided")
+	}
+	return sig.VerifyAggregateWithPolicy(suite, ctx.Statement(suite, msg), publics, policy)
+}
+
+// VerifyRefusalInContext checks that the signature is a collective refusal
+// of the message, bound to the given context, using the public keys and the
+// policy.
+func (sig BlsSignature) VerifyRefusalInContext(suite pairing.Suite, ctx *SigningContext, msg []byte, publics []kyber.Point, policy sign.Policy) error {
+	if msg == nil {
+		return errors.New("no message provided")
+	}
+	return sig.VerifyRefusalWithPolicy(suite, ctx.Statement(suite, msg), publics, policy)
+}
+
+// SigningContext returns the context that the signatures of the session are
+// bound to, or nil if they are made over the message itself.
+func (p *BlsCosi) SigningContext() *SigningContext {
+	if !p.Params.BindSession {
+		return nil
+	}
+	return &SigningContext{
+		Protocol: p.ProtocolName(),
+		RosterID: p.Roster().ID,
+		Nonce:    p.session.Nonce,
+	}
+}
+
+// statement returns what the nodes sign for the message of the session.
+func (p *BlsCosi) statement() []byte {
+	if ctx := p.SigningContext(); ctx != nil {
+		return ctx.Statement(p.suite, p.Msg)
+	}
+	return p.Msg
+}
@@ -0,0 +1,39 @@
+package protocol
+
+// Helpers working on raw participation masks, using the same bit ordering as
+// sign.Mask: bit i is the (i mod 8)-th lowest bit of byte i/8.
+
+// isBitSet returns true if the i-th bit of the mask is enabled.
+func isBitSet(mask []byte, i int) bool {
+	if i < 0 || i/8 >= len(mask) {
+		return false
+	}
+	return mask[i/8]&(1<<uint(i%8)) != 0
+}
+
+// orMasks returns the union of both masks.
+func orMasks(a, b []byte) []byte {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	res := make([]byte, len(a))
+	copy(res, a)
+	for i := range b {
+		res[i] |= b[i]
+	}
+	return res
+}
+
+// isSubset returns true if every bit enabled in a is also enabled in b.
+func isSubset(a, b []byte) bool {
+	for i := range a {
+		var other byte
+		if i < len(b) {
+			other = b[i]
+		}
+		if a[i]&^other != 0 {
+			return false
+		}
+	}
+	return true
+}
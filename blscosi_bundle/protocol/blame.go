@@ -0,0 +1,162 @@
+package protocol
+
+import (
+	"bytes"
+	"sort"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// Culprit is a stored response that made the final signature invalid. It is
+// kept as evidence: its signature doesn't verify against the public keys of
+// its mask.
+type Culprit struct {
+	Index     uint32
+	Signature []byte
+	Mask      []byte
+}
+
+// findCulprits bisects the stored responses to find the ones whose signature
+// is invalid.
+func (p *BlsCosi) findCulprits(responses Responses) []Culprit {
+	var indices []uint32
+	for idx := range responses.Map() {
+		indices = append(indices, idx)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	var culprits []Culprit
+	var bisect func([]uint32)
+	bisect = func(indices []uint32) {
+		if len(indices) == 0 || p.checkResponses(responses, indices) {
+			return
+		}
+		if len(indices) == 1 {
+			r := responses.Map()[indices[0]]
+			culprits = append(culprits, Culprit{indices[0], r.Signature, r.Mask})
+			return
+		}
+		bisect(indices[:len(indices)/2])
+		bisect(indices[len(indices)/2:])
+	}
+	bisect(indices)
+
+	return culprits
+}
+
+// checkResponses returns true if the signatures of the responses stored at
+// the given indices are valid altogether.
+func (p *BlsCosi) checkResponses(responses Responses, indices []uint32) bool {
+	publics := p.Publics()
+	keys := make([]kyber.Point, len(indices))
+	sigs := make([][]byte, len(indices))
+	for i, idx := range indices {
+		r := responses.Map()[idx]
+		key, err := responses.PublicKey(p.suite, publics, idx, r)
+		if err != nil {
+			return false
+		}
+		keys[i] = key
+		sigs[i] = r.Signature
+	}
+	return batchVerify(p.suite, p.statement(), keys, sigs) == nil
+}
+
+// aggregate creates the final signature out of the responses. If it is
+// invalid, the faulty responses are found, dropped and returned, and the
+// remaining ones are aggregated. In tree mode, a faulty response may be an
+// aggregate hiding valid signatures: our own is added back, and the others
+// can only come back with the gossip.
+func (p *BlsCosi) aggregate(responses Responses) (BlsSignature, []Culprit, error) {
+	finalSig, err := p.aggregateResponses(responses)
+	if err != nil {
+		return nil, nil, err
+	}
+	if finalSig.VerifyAggregateWithPolicy(p.suite, p.statement(), p.Publics(), anyPolicy{}) == nil {
+		return finalSig, nil, nil
+	}
+
+	culprits := p.findCulprits(responses)
+	log.Lvl1(p.ServerIdentity(), "found", len(culprits), "invalid responses in the final signature")
+	for _, culprit := range culprits {
+		responses.Remove(culprit.Index)
+	}
+	idx := p.TreeNode().RosterIndex
+	if _, refused := p.refusals[uint32(idx)]; !refused && !isBitSet(responses.Participation(), idx) {
+		own, ownIdx, err := p.makeResponse()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = responses.Add(ownIdx, own); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	finalSig, err = p.aggregateResponses(responses)
+	return finalSig, culprits, err
+}
+
+// checkEnough drops the invalid responses and returns true if the remaining
+// ones are still enough to finalize the signature. The dropped responses are
+// added to the culprits.
+func (p *BlsCosi) checkEnough(responses Responses) (bool, error) {
+	sig, culprits, err := p.aggregate(responses)
+	if err != nil {
+		return false, err
+	}
+	p.Culprits = append(p.Culprits, culprits...)
+	p.checked = sig
+	p.checkedMask = append([]byte(nil), responses.Participation()...)
+	return p.isEnough(responses), nil
+}
+
+// finalAggregate returns the aggregate made by checkEnough if the responses
+// didn't change since, and aggregates them again otherwise.
+func (p *BlsCosi) finalAggregate(responses Responses) (BlsSignature, []Culprit, error) {
+	if p.checked != nil && bytes.Equal(p.checkedMask, responses.Participation()) {
+		return p.checked, nil, nil
+	}
+	return p.aggregate(responses)
+}
+
+// withoutCulprits returns the received responses except the ones already
+// found to be invalid, so that they aren't merged again.
+func (p *BlsCosi) withoutCulprits(received map[uint32](*Response)) map[uint32](*Response) {
+	if len(p.Culprits) == 0 {
+		return received
+	}
+	valid := make(map[uint32](*Response))
+	for idx, r := range received {
+		if !p.isCulprit(idx, r) {
+			valid[idx] = r
+		}
+	}
+	return valid
+}
+
+func (p *BlsCosi) isCulprit(idx uint32, r *Response) bool {
+	for _, culprit := range p.Culprits {
+		if culprit.Index == idx && bytes.Equal(culprit.Signature, r.Signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateResponses aggregates the signatures and the masks of the
+// responses.
+func (p *BlsCosi) aggregateResponses(responses Responses) (BlsSignature, error) {
+	signaturePoint, finalMask, err := responses.Aggregate(p.suite, p.Publics())
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signaturePoint.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), signature, finalMask.Mask())
+	return newBlsSignature(signature, finalMask.Mask(), finalMask.CountTotal()), nil
+}
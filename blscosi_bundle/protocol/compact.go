@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// CompactResponse is a response sent in a compact rumor. Its mask is
+// trimmed of the empty bytes on both ends, and Offset is the index of the
+// first remaining byte in the full mask. A nil mask stands for the single
+// bit of Index, which is the case of every response that isn't aggregated.
+type CompactResponse struct {
+	Index     uint32
+	Signature []byte
+	Offset    uint32
+	Mask      []byte
+}
+
+// compactResponses returns the compact form of the responses, in the order
+// of their indices.
+func compactResponses(responses map[uint32](*Response)) []CompactResponse {
+	compact := make([]CompactResponse, 0, len(responses))
+	for idx, r := range responses {
+		c := CompactResponse{Index: idx, Signature: r.Signature}
+		if !isSingleBit(r.Mask, int(idx)) {
+			c.Offset, c.Mask = trimMask(r.Mask)
+		}
+		compact = append(compact, c)
+	}
+	sort.Slice(compact, func(i, j int) bool { return compact[i].Index < compact[j].Index })
+	return compact
+}
+
+// expandResponses returns the responses of the rumor, with the compact
+// responses expanded to full-width masks for a roster of n nodes.
+func expandResponses(rumor Rumor, n int) (map[uint32](*Response), error) {
+	if len(rumor.Compact) == 0 {
+		return rumor.ResponseMap, nil
+	}
+
+	size := (n + 7) / 8
+	responses := make(map[uint32](*Response), len(rumor.ResponseMap)+len(rumor.Compact))
+	for idx, r := range rumor.ResponseMap {
+		responses[idx] = r
+	}
+	for _, c := range rumor.Compact {
+		if int(c.Index) >= n {
+			return nil, fmt.Errorf("compact response with index %d out of the roster", c.Index)
+		}
+		mask := make([]byte, size)
+		if c.Mask == nil {
+			mask[c.Index/8] = 1 << (c.Index % 8)
+		} else if int(c.Offset)+len(c.Mask) > size {
+			return nil, fmt.Errorf("compact response %d has a mask out of the roster", c.Index)
+		} else {
+			copy(mask[c.Offset:], c.Mask)
+		}
+		responses[c.Index] = &Response{Signature: c.Signature, Mask: mask}
+	}
+	return responses, nil
+}
+
+// trimMask removes the empty bytes on both ends of the mask, and returns
+// the offset of the first byte that is kept.
+func trimMask(mask []byte) (uint32, []byte) {
+	start := 0
+	for start < len(mask) && mask[start] == 0 {
+		start++
+	}
+	end := len(mask)
+	for end > start && mask[end-1] == 0 {
+		end--
+	}
+	return uint32(start), mask[start:end]
+}
+
+// isSingleBit returns true if the bit i is the only one set in the mask.
+func isSingleBit(mask []byte, i int) bool {
+	if !isBitSet(mask, i) {
+		return false
+	}
+	single := make([]byte, len(mask))
+	single[i/8] = 1 << uint(i%8)
+	return bytes.Equal(mask, single)
+}
+
+// newRumor creates the rumor for a peer, with the given responses. In
+// compact mode, the session and the message are left out once the peer is
+// known to have them, and the responses are compacted.
+func (p *BlsCosi) newRumor(state *peerState, responses map[uint32](*Response), participation []byte, data []byte) *Rumor {
+	if !p.Params.CompactRumors {
+		return &Rumor{p.session, responses, p.Msg, participation, p.refusals, data, nil, nil}
+	}
+
+	rumor := &Rumor{
+		Participation: participation,
+		Refusals:      p.refusals,
+		Data:          data,
+		SessionRef:    p.session.Nonce,
+		Compact:       compactResponses(responses),
+	}
+	if !state.started && !state.sessionSent {
+		rumor.Session = p.session
+		rumor.Msg = p.Msg
+		state.sessionSent = true
+	}
+	return rumor
+}
+
+// isRumorSession returns true if the rumor belongs to the current session,
+// either with the full session header or with a reference to it.
+func (p *BlsCosi) isRumorSession(rumor Rumor) bool {
+	if rumor.Session.Signature == nil {
+		return len(rumor.SessionRef) > 0 && bytes.Equal(rumor.SessionRef, p.session.Nonce)
+	}
+	return p.isSession(rumor.Session)
+}
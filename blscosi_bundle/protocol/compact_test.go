@@ -0,0 +1,32 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactResponses(t *testing.T) {
+	responses := map[uint32](*Response){
+		3:  {Signature: []byte{1}, Mask: []byte{0x08, 0x00, 0x00}},
+		9:  {Signature: []byte{2}, Mask: []byte{0x00, 0x06, 0x00}},
+		17: {Signature: []byte{3}, Mask: []byte{0x00, 0x00, 0x02}},
+	}
+	compact := compactResponses(responses)
+	require.Len(t, compact, 3)
+	require.Nil(t, compact[0].Mask)
+	require.Equal(t, uint32(1), compact[1].Offset)
+	require.Equal(t, []byte{0x06}, compact[1].Mask)
+	require.Nil(t, compact[2].Mask)
+
+	expanded, err := expandResponses(Rumor{Compact: compact}, 20)
+	require.NoError(t, err)
+	require.Equal(t, responses, expanded)
+
+	// Masks out of the roster are rejected
+	_, err = expandResponses(Rumor{Compact: compact}, 16)
+	require.Error(t, err)
+	compact[1].Offset = 3
+	_, err = expandResponses(Rumor{Compact: compact[:2]}, 20)
+	require.Error(t, err)
+}
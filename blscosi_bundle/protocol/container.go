@@ -0,0 +1,185 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/protobuf"
+)
+
+// SignatureVersion is the version of the signature container written by
+// this package. Containers of older versions can still be read. Version 2
+// adds the signing context.
+const SignatureVersion = 2
+
+// containerMagic starts every marshalled container, so that it can't be
+// mistaken for a raw signature.
+const containerMagic = "bundleCoSi signature:"
+
+// Scheme identifies how the signatures of the nodes are aggregated.
+type Scheme int
+
+const (
+	// SchemeBDN aggregates the signatures with the coefficients of the BDN
+	// scheme, which protects against rogue public keys. It is the scheme of
+	// this protocol, and the only one that is verified.
+	SchemeBDN Scheme = iota
+)
+
+// RequiredPolicy is the minimal policy that the verifier of a container
+// requires, whatever the container claims. Threshold is the minimal weight
+// of the signers, the default threshold of the roster when it is zero.
+// Weights must be the ones of the container, and nil means that every node
+// weighs one. Groups must each have enough signers.
+type RequiredPolicy struct {
+	Threshold int
+	Weights   []int
+	Groups    []Group
+}
+
+// SignatureContainer is the self-describing form of a collective
+// signature, meant to be archived. Besides the signature, it holds what is
+// needed to verify it with the public keys of the roster: the suite, the
+// aggregation scheme, the roster, the policy of the session, the encoding of
+// the participation mask and the context, for the signatures bound to their
+// session.
+type SignatureContainer struct {
+	Version      int
+	Suite        string
+	Scheme       Scheme
+	RosterID     onet.RosterID
+	Threshold    int
+	Weights      []int
+	Groups       []Group
+	MaskEncoding MaskEncoding
+	Refusal      bool // the signature is a refusal certificate
+	Signature    BlsSignature
+	Context      *SigningContext
+}
+
+// NewSignatureContainer describes a signature made by this protocol for the
+// roster of n nodes, with the default threshold. The threshold, the weights
+// and the groups of the session must be set if they are not the default
+// ones. It is also the migration path of the raw signatures, all made with
+// the BDN scheme.
+func NewSignatureContainer(suite pairing.Suite, sig BlsSignature, rosterID onet.RosterID, n int) (*SignatureContainer, error) {
+	encoding, err := sig.MaskEncoding(suite, n)
+	if err != nil {
+		return nil, err
+	}
+	return &SignatureContainer{
+		Version:      SignatureVersion,
+		Suite:        SuiteName(suite),
+		Scheme:       SchemeBDN,
+		RosterID:     rosterID,
+		Threshold:    DefaultThreshold(n),
+		MaskEncoding: encoding,
+		Signature:    sig,
+	}, nil
+}
+
+// Marshal returns the binary form of the container.
+func (c *SignatureContainer) Marshal() ([]byte, error) {
+	data, err := protobuf.Encode(c)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(containerMagic), data...), nil
+}
+
+// UnmarshalSignatureContainer reads a container written by Marshal, in
+// this or an older version.
+func UnmarshalSignatureContainer(data []byte) (*SignatureContainer, error) {
+	if !bytes.HasPrefix(data, []byte(containerMagic)) {
+		return nil, errors.New("not a signature container")
+	}
+	c := &SignatureContainer{}
+	err := protobuf.Decode(data[len(containerMagic):], c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Version < 1 || c.Version > SignatureVersion {
+		return nil, fmt.Errorf("unsupported signature version %d", c.Version)
+	}
+	return c, nil
+}
+
+// Verify checks that the container holds a collective signature of the
+// message, or a refusal certificate if Refusal is set, made by the given
+// public keys of the roster. The signature must fulfil both the required
+// policy and the one of the container, which can only be stricter: a
+// container with a lower threshold or other weights is rejected. A refusal
+// certificate must make the required policy unreachable, with the
+// threshold of the container if it is lower.
+func (c *SignatureContainer) Verify(suite pairing.Suite, msg []byte, rosterID onet.RosterID, publics []kyber.Point, required RequiredPolicy) error {
+	if c.Suite != SuiteName(suite) {
+		return fmt.Errorf("signature made with the suite %s", c.Suite)
+	}
+	if c.Scheme != SchemeBDN {
+		return fmt.Errorf("unknown aggregation scheme %d", c.Scheme)
+	}
+	if c.RosterID != rosterID {
+		return errors.New("signature made by another roster")
+	}
+	if err := checkWeights(c.Weights, len(publics)); err != nil {
+		return err
+	}
+	if err := checkGroups(c.Groups, len(publics)); err != nil {
+		return err
+	}
+	if !equalWeights(c.Weights, required.Weights) {
+		return errors.New("signature made with other weights")
+	}
+	threshold := required.Threshold
+	if threshold == 0 {
+		threshold = DefaultThreshold(TotalWeight(required.Weights, len(publics)))
+	}
+	encoding, err := c.Signature.MaskEncoding(suite, len(publics))
+	if err != nil {
+		return err
+	}
+	if encoding != c.MaskEncoding {
+		return fmt.Errorf("mask encoded with %d instead of %d", encoding, c.MaskEncoding)
+	}
+
+	if c.Context != nil {
+		if c.Context.RosterID != rosterID {
+			return errors.New("signature bound to another roster")
+		}
+		msg = c.Context.Statement(suite, msg)
+	}
+
+	if c.Refusal {
+		// The quorum of refusers is the one of the verifier, the threshold
+		// and the groups of the certificate are not used
+		policy := NewRefusalPolicy(required.Weights, threshold, required.Groups)
+		return c.Signature.VerifyRefusalWithPolicy(suite, msg, publics, policy)
+	}
+
+	if c.Threshold < threshold {
+		return fmt.Errorf("signature made with a threshold of %d instead of %d", c.Threshold, threshold)
+	}
+	policy := AllPolicies{
+		NewWeightedPolicy(required.Weights, c.Threshold),
+		NewGroupPolicy(required.Groups),
+		NewGroupPolicy(c.Groups),
+	}
+	return c.Signature.VerifyAggregateWithPolicy(suite, msg, publics, policy)
+}
+
+// equalWeights tells whether both are the same weights.
+func equalWeights(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
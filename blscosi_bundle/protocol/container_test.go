@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestSignatureContainer(t *testing.T) {
+	n := 4
+	publics := make([]kyber.Point, n)
+	privates := make([]kyber.Scalar, n)
+	for i := range publics {
+		privates[i], publics[i] = bdn.NewKeyPair(testSuite, random.New())
+	}
+	msg := []byte("hello container")
+	rosterID := onet.RosterID{1}
+
+	mask, err := sign.NewMask(testSuite, publics, nil)
+	require.NoError(t, err)
+	var sigs [][]byte
+	for i := 0; i < 3; i++ {
+		require.NoError(t, mask.SetBit(i, true))
+		sig, err := bdn.Sign(testSuite, privates[i], msg)
+		require.NoError(t, err)
+		sigs = append(sigs, sig)
+	}
+	aggSig, err := bdn.AggregateSignatures(testSuite, sigs, mask)
+	require.NoError(t, err)
+	raw, err := aggSig.MarshalBinary()
+	require.NoError(t, err)
+	sig := newBlsSignature(raw, mask.Mask(), n)
+
+	// A raw signature is migrated to a container
+	c, err := NewSignatureContainer(testSuite, sig, rosterID, n)
+	require.NoError(t, err)
+	require.Equal(t, DefaultThreshold(n), c.Threshold)
+	data, err := c.Marshal()
+	require.NoError(t, err)
+
+	decoded, err := UnmarshalSignatureContainer(data)
+	require.NoError(t, err)
+	require.Equal(t, c.Signature, decoded.Signature)
+	require.NoError(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{}))
+
+	// The container can't be verified out of its context
+	require.Error(t, decoded.Verify(testSuite, []byte("another message"), rosterID, publics, RequiredPolicy{}))
+	require.Error(t, decoded.Verify(testSuite, msg, onet.RosterID{2}, publics, RequiredPolicy{}))
+	decoded.Threshold = n
+	require.Error(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{}))
+	decoded.Threshold = c.Threshold
+	decoded.Suite = "ed25519"
+	require.Error(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{}))
+	decoded.Suite = c.Suite
+	decoded.Scheme = SchemeBDN + 1
+	require.Error(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{}))
+	decoded.Scheme = SchemeBDN
+
+	// The container can't weaken the policy of the verifier
+	decoded.Threshold = 1
+	require.Error(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{}))
+	require.NoError(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{Threshold: 1}))
+	decoded.Threshold = c.Threshold
+	decoded.Weights = []int{3, 3, 3, 1}
+	require.Error(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{}))
+	require.NoError(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{Threshold: 3, Weights: decoded.Weights}))
+	decoded.Weights = nil
+	groups := []Group{{Name: "last", Members: []uint32{3}, K: 1}}
+	require.Error(t, decoded.Verify(testSuite, msg, rosterID, publics, RequiredPolicy{Groups: groups}))
+
+	// Raw signatures and newer versions are rejected
+	_, err = UnmarshalSignatureContainer(sig)
+	require.Error(t, err)
+	c.Version = SignatureVersion + 1
+	data, err = c.Marshal()
+	require.NoError(t, err)
+	_, err = UnmarshalSignatureContainer(data)
+	require.Error(t, err)
+}
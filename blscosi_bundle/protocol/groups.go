@@ -0,0 +1,164 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/onet/v3"
+)
+
+// Group is a named set of roster members, for example the nodes run by the
+// same organisation, of which at least K must sign.
+type Group struct {
+	Name    string
+	Members []uint32 // roster indices
+	K       int
+}
+
+// GroupPolicy is a sign.Policy that requires at least K signers in each of
+// the groups, so that a single organisation running many nodes can't meet
+// the threshold alone.
+type GroupPolicy struct {
+	Groups []Group
+}
+
+// NewGroupPolicy returns a policy requiring enough signers in every group.
+func NewGroupPolicy(groups []Group) *GroupPolicy {
+	return &GroupPolicy{Groups: groups}
+}
+
+// Check returns true if every group has enough signers in the mask.
+func (p *GroupPolicy) Check(m *sign.Mask) bool {
+	return groupsSatisfied(m.Mask(), p.Groups)
+}
+
+// AllPolicies is a sign.Policy fulfilled when every one of its policies is.
+type AllPolicies []sign.Policy
+
+// Check returns true if the mask fulfils every policy.
+func (policies AllPolicies) Check(m *sign.Mask) bool {
+	for _, policy := range policies {
+		if !policy.Check(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// RefusalPolicy is the sign.Policy of the refusal certificates: the refusers
+// must be a quorum, weighing at least the threshold, and make the signature
+// impossible: either the threshold is unreachable, or one of the groups
+// can't have K signers anymore.
+type RefusalPolicy struct {
+	Weights   []int
+	Threshold int
+	Groups    []Group
+}
+
+// NewRefusalPolicy returns the policy proving that a signature with the
+// given weights, threshold and groups can't be made.
+func NewRefusalPolicy(weights []int, threshold int, groups []Group) *RefusalPolicy {
+	return &RefusalPolicy{Weights: weights, Threshold: threshold, Groups: groups}
+}
+
+// Check returns true if the refusers of the mask make the signature
+// impossible.
+func (p *RefusalPolicy) Check(m *sign.Mask) bool {
+	total := TotalWeight(p.Weights, m.CountTotal())
+	weight := MaskWeight(m.Mask(), p.Weights)
+	if weight < p.Threshold {
+		return false
+	}
+	return weight > total-p.Threshold || groupsUnreachable(m.Mask(), p.Groups)
+}
+
+// GroupsByDescription groups the members of the roster by the description
+// of their server identity, which usually names the organisation running
+// the node, and requires k signers in each group, or every member of the
+// smaller groups.
+func GroupsByDescription(ro *onet.Roster, k int) []Group {
+	byName := make(map[string]*Group)
+	var names []string
+	for i, si := range ro.List {
+		g, ok := byName[si.Description]
+		if !ok {
+			g = &Group{Name: si.Description}
+			byName[si.Description] = g
+			names = append(names, si.Description)
+		}
+		g.Members = append(g.Members, uint32(i))
+	}
+	sort.Strings(names)
+
+	groups := make([]Group, len(names))
+	for i, name := range names {
+		groups[i] = *byName[name]
+		groups[i].K = k
+		if k > len(groups[i].Members) {
+			groups[i].K = len(groups[i].Members)
+		}
+	}
+	return groups
+}
+
+// countMembers returns the number of members of the group enabled in the
+// mask.
+func (g Group) countMembers(mask []byte) int {
+	count := 0
+	for _, idx := range g.Members {
+		if isBitSet(mask, int(idx)) {
+			count++
+		}
+	}
+	return count
+}
+
+// groupsSatisfied returns true if every group has at least K members in the
+// mask.
+func groupsSatisfied(mask []byte, groups []Group) bool {
+	for _, g := range groups {
+		if g.countMembers(mask) < g.K {
+			return false
+		}
+	}
+	return true
+}
+
+// groupsUnreachable returns true if the refusals of the mask leave one of
+// the groups without K members that could still sign.
+func groupsUnreachable(refusals []byte, groups []Group) bool {
+	for _, g := range groups {
+		if g.countMembers(refusals) > len(g.Members)-g.K {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGroups returns an error if the groups can't be used for a roster of
+// n nodes.
+func checkGroups(groups []Group, n int) error {
+	names := make(map[string]bool)
+	for _, g := range groups {
+		if names[g.Name] {
+			return fmt.Errorf("duplicate group %q", g.Name)
+		}
+		names[g.Name] = true
+
+		members := make(map[uint32]bool)
+		for _, idx := range g.Members {
+			if int(idx) >= n {
+				return fmt.Errorf("group %q has member %d out of the roster", g.Name, idx)
+			}
+			if members[idx] {
+				return fmt.Errorf("group %q has member %d twice", g.Name, idx)
+			}
+			members[idx] = true
+		}
+		if g.K < 1 || g.K > len(g.Members) {
+			return fmt.Errorf("group %q requires %d of its %d members", g.Name, g.K, len(g.Members))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestGroupPolicy(t *testing.T) {
+	publics := make([]kyber.Point, 5)
+	for i := range publics {
+		_, publics[i] = bdn.NewKeyPair(testSuite, random.New())
+	}
+	mask, err := sign.NewMask(testSuite, publics, nil)
+	require.NoError(t, err)
+	require.NoError(t, mask.SetBit(0, true))
+	require.NoError(t, mask.SetBit(1, true))
+	require.NoError(t, mask.SetBit(2, true))
+
+	// The first organisation alone reaches a threshold of 3
+	groups := []Group{
+		{Name: "a", Members: []uint32{0, 1, 2}, K: 1},
+		{Name: "b", Members: []uint32{3, 4}, K: 1},
+	}
+	require.True(t, NewWeightedPolicy(nil, 3).Check(mask))
+	require.False(t, NewGroupPolicy(groups).Check(mask))
+	require.False(t, AllPolicies{NewWeightedPolicy(nil, 3), NewGroupPolicy(groups)}.Check(mask))
+
+	require.NoError(t, mask.SetBit(4, true))
+	require.True(t, AllPolicies{NewWeightedPolicy(nil, 3), NewGroupPolicy(groups)}.Check(mask))
+
+	// Refusals of the whole second organisation make the groups unreachable,
+	// and are a quorum for a threshold of 2
+	refusals, err := sign.NewMask(testSuite, publics, nil)
+	require.NoError(t, err)
+	require.NoError(t, refusals.SetBit(3, true))
+	require.False(t, NewRefusalPolicy(nil, 2, groups).Check(refusals))
+	require.NoError(t, refusals.SetBit(4, true))
+	require.True(t, NewRefusalPolicy(nil, 2, groups).Check(refusals))
+	require.False(t, NewRefusalPolicy(nil, 2, nil).Check(refusals))
+
+	// but not for a threshold of 3
+	require.False(t, NewRefusalPolicy(nil, 3, groups).Check(refusals))
+	require.NoError(t, refusals.SetBit(0, true))
+	require.True(t, NewRefusalPolicy(nil, 3, groups).Check(refusals))
+
+	require.NoError(t, checkGroups(groups, 5))
+	require.Error(t, checkGroups(groups, 4))
+	require.Error(t, checkGroups([]Group{{Name: "a", Members: []uint32{0, 0}, K: 1}}, 5))
+	require.Error(t, checkGroups([]Group{{Name: "a", Members: []uint32{0}, K: 2}}, 5))
+	require.Error(t, checkGroups([]Group{groups[0], groups[0]}, 5))
+}
+
+func TestGroupsByDescription(t *testing.T) {
+	var list []*network.ServerIdentity
+	for i, desc := range []string{"b", "a", "b", "b"} {
+		_, public := bdn.NewKeyPair(testSuite, random.New())
+		si := network.NewServerIdentity(public, network.NewLocalAddress(fmt.Sprintf("node%d", i)))
+		si.Description = desc
+		list = append(list, si)
+	}
+	groups := GroupsByDescription(onet.NewRoster(list), 2)
+	require.Equal(t, []Group{
+		{Name: "a", Members: []uint32{1}, K: 1},
+		{Name: "b", Members: []uint32{0, 2, 3}, K: 2},
+	}, groups)
+}
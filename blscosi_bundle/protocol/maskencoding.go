@@ -0,0 +1,156 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go.dedis.ch/kyber/v3/pairing"
+)
+
+// MaskEncoding identifies how the participation mask is appended to a
+// signature.
+type MaskEncoding int
+
+const (
+	// RawMask is the bitmask of ceil(n/8) bytes. It is the only encoding
+	// without a flag, and it is recognized by its length.
+	RawMask MaskEncoding = iota
+	// SparseMask is the list of the enabled indices, each one written as the
+	// uvarint of the gap since the previous one.
+	SparseMask
+	// RunLengthMask is the list of the lengths of the runs of disabled and
+	// enabled bits, alternatively, starting with disabled bits. Each length
+	// is written as a uvarint.
+	RunLengthMask
+)
+
+// EncodeMask returns the shortest encoding of the participation mask of n
+// nodes. The other encodings start with their flag, and are only used when
+// they are shorter than the raw mask, so that the raw masks of the existing
+// signatures are still read correctly.
+func EncodeMask(mask []byte, n int) []byte {
+	best := mask
+	for _, encoded := range [][]byte{encodeSparse(mask, n), encodeRunLength(mask, n)} {
+		if len(encoded) < len(best) {
+			best = encoded
+		}
+	}
+	return best
+}
+
+// DecodeMask returns the raw participation mask of n nodes from any of the
+// encodings.
+func DecodeMask(data []byte, n int) ([]byte, error) {
+	size := (n + 7) / 8
+	if len(data) == size {
+		return data, nil
+	}
+	if len(data) == 0 || len(data) > size {
+		return nil, fmt.Errorf("mask of %d bytes for %d nodes", len(data), n)
+	}
+
+	switch MaskEncoding(data[0]) {
+	case SparseMask:
+		return decodeSparse(data[1:], n)
+	case RunLengthMask:
+		return decodeRunLength(data[1:], n)
+	default:
+		return nil, fmt.Errorf("unknown mask encoding %d", data[0])
+	}
+}
+
+func encodeSparse(mask []byte, n int) []byte {
+	data := []byte{byte(SparseMask)}
+	next := 0
+	for i := 0; i < n; i++ {
+		if isBitSet(mask, i) {
+			data = appendUvarint(data, uint64(i-next))
+			next = i + 1
+		}
+	}
+	return data
+}
+
+func decodeSparse(data []byte, n int) ([]byte, error) {
+	mask := make([]byte, (n+7)/8)
+	next := uint64(0)
+	for len(data) > 0 {
+		gap, read := binary.Uvarint(data)
+		if read <= 0 {
+			return nil, errors.New("invalid sparse mask")
+		}
+		data = data[read:]
+		idx := next + gap
+		if idx < next || idx >= uint64(n) {
+			return nil, errors.New("sparse mask with an index out of the roster")
+		}
+		mask[idx/8] |= 1 << (idx % 8)
+		next = idx + 1
+	}
+	return mask, nil
+}
+
+func encodeRunLength(mask []byte, n int) []byte {
+	data := []byte{byte(RunLengthMask)}
+	enabled := false
+	run := 0
+	for i := 0; i < n; i++ {
+		if isBitSet(mask, i) != enabled {
+			data = appendUvarint(data, uint64(run))
+			enabled = !enabled
+			run = 0
+		}
+		run++
+	}
+	return appendUvarint(data, uint64(run))
+}
+
+func decodeRunLength(data []byte, n int) ([]byte, error) {
+	mask := make([]byte, (n+7)/8)
+	enabled := false
+	total := uint64(0)
+	for len(data) > 0 {
+		run, read := binary.Uvarint(data)
+		if read <= 0 {
+			return nil, errors.New("invalid run-length mask")
+		}
+		data = data[read:]
+		if run > uint64(n)-total {
+			return nil, errors.New("run-length mask longer than the roster")
+		}
+		if enabled {
+			for i := total; i < total+run; i++ {
+				mask[i/8] |= 1 << (i % 8)
+			}
+		}
+		total += run
+		enabled = !enabled
+	}
+	if total != uint64(n) {
+		return nil, errors.New("run-length mask shorter than the roster")
+	}
+	return mask, nil
+}
+
+func appendUvarint(data []byte, x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(data, buf[:binary.PutUvarint(buf, x)]...)
+}
+
+// MaskEncoding returns the encoding of the participation mask appended to
+// the signature, for a roster of n nodes.
+func (sig BlsSignature) MaskEncoding(suite pairing.Suite, n int) (MaskEncoding, error) {
+	lenCom := suite.G1().PointLen()
+	if len(sig) < lenCom {
+		return RawMask, errors.New("signature too short to get mask")
+	}
+	data := sig[lenCom:]
+	if _, err := DecodeMask(data, n); err != nil {
+		return RawMask, err
+	}
+	if len(data) == (n+7)/8 {
+		return RawMask, nil
+	}
+	return MaskEncoding(data[0]), nil
+}
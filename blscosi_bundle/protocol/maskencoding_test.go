@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestMaskEncoding(t *testing.T) {
+	n := 100
+	full := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		if i != 42 {
+			full[i/8] |= 1 << uint(i%8)
+		}
+	}
+	sparse := make([]byte, (n+7)/8)
+	sparse[5] = 0x10
+	sparse[11] = 0x01
+	alternate := make([]byte, (n+7)/8)
+	for i := range alternate {
+		alternate[i] = 0x55
+	}
+	alternate[len(alternate)-1] = 0x05
+
+	for _, test := range []struct {
+		mask     []byte
+		encoding MaskEncoding
+	}{
+		{full, RunLengthMask},
+		{sparse, SparseMask},
+		{alternate, RawMask},
+		{make([]byte, (n+7)/8), SparseMask},
+	} {
+		encoded := EncodeMask(test.mask, n)
+		require.True(t, len(encoded) <= len(test.mask))
+		if test.encoding == RawMask {
+			require.Equal(t, test.mask, encoded)
+		} else {
+			require.Equal(t, byte(test.encoding), encoded[0])
+		}
+		decoded, err := DecodeMask(encoded, n)
+		require.NoError(t, err)
+		require.Equal(t, test.mask, decoded)
+	}
+
+	// Invalid encodings are rejected
+	_, err := DecodeMask([]byte{byte(SparseMask), 100}, n)
+	require.Error(t, err)
+	_, err = DecodeMask([]byte{byte(RunLengthMask), 10, 20}, n)
+	require.Error(t, err)
+	_, err = DecodeMask([]byte{byte(RunLengthMask), 101}, n)
+	require.Error(t, err)
+	_, err = DecodeMask([]byte{0xff}, n)
+	require.Error(t, err)
+	_, err = DecodeMask(make([]byte, 14), n)
+	require.Error(t, err)
+}
+
+func TestMaskEncoding_Signature(t *testing.T) {
+	n := 64
+	publics := make([]kyber.Point, n)
+	privates := make([]kyber.Scalar, n)
+	for i := range publics {
+		privates[i], publics[i] = bdn.NewKeyPair(testSuite, random.New())
+	}
+	msg := []byte("hello sparse mask")
+
+	mask, err := sign.NewMask(testSuite, publics, nil)
+	require.NoError(t, err)
+	var sigs [][]byte
+	for _, i := range []int{3, 40} {
+		require.NoError(t, mask.SetBit(i, true))
+		sig, err := bdn.Sign(testSuite, privates[i], msg)
+		require.NoError(t, err)
+		sigs = append(sigs, sig)
+	}
+	aggSig, err := bdn.AggregateSignatures(testSuite, sigs, mask)
+	require.NoError(t, err)
+	raw, err := aggSig.MarshalBinary()
+	require.NoError(t, err)
+
+	// The sparse mask is read back by the verification
+	sig := newBlsSignature(raw, mask.Mask(), n)
+	require.True(t, len(sig) < len(raw)+len(mask.Mask()))
+	decoded, err := sig.GetMask(testSuite, publics)
+	require.NoError(t, err)
+	require.Equal(t, mask.Mask(), decoded.Mask())
+	require.NoError(t, sig.VerifyAggregateWithPolicy(testSuite, msg, publics, sign.NewThresholdPolicy(2)))
+}
@@ -1,23 +1,78 @@
 package protocol
 
 import (
+	"errors"
 	"time"
 )
 
 // Parameters holds a set of parameters, mainly for simulation purposes
 type Parameters struct {
-	GossipTick    time.Duration // periodic interval
-	RumorPeers    int           // number of peers that a rumor message is sent to
-	ShutdownPeers int           // number of peers that the shutdown message is sent to
-	TreeMode      bool          // aggregate messages wherever possible
+	GossipTick      time.Duration // periodic interval
+	RumorPeers      int           // number of peers that a rumor message is sent to
+	ShutdownPeers   int           // number of peers that the shutdown message is sent to
+	TreeMode        bool          // aggregate messages wherever possible
+	PeerSelection   PeerSelection // strategy used to pick the rumor targets
+	DeltaRumors     bool          // only send the signatures that the target is missing
+	FullRumorPeriod int           // in delta mode, send full rumors every that many ticks (0: never)
+	PushPull        bool          // send digests and let the peers reply with the missing signatures
+	CompactRumors   bool          // send the session once to each peer, and the responses with trimmed masks
+	VerifyResponses bool          // verify the incoming signatures before storing them
+	BatchVerify     bool          // verify all the new signatures of a rumor at once
+	Deadline        time.Duration // hard deadline of the protocol on every node
+	GossipDeadline  time.Duration // the gossip stops after that, even without enough signatures
+	Linger          time.Duration // time a node keeps answering with shutdowns once it is done
+	ShutdownQuorum  int           // a done node terminates once that many peers sent it the shutdown (0: never)
+	QuietPeriod     time.Duration // a done node terminates after that long without any rumor (0: never)
+	FailoverAfter   time.Duration // any node with enough signatures finalizes them if no shutdown came by then (0: never)
+	Leaderless      bool          // every node finalizes the signature and ends with it
+	GracePeriod     time.Duration // the signatures are still collected that long after reaching the threshold
+	TargetCoverage  int           // the grace period ends once that percentage of the nodes signed (0: never)
+	BindSession     bool          // sign a digest bound to the protocol, the roster and the session instead of the message
 }
 
 // DefaultParams returns a set of default parameters
 func DefaultParams() Parameters {
 	return Parameters{
-		GossipTick:    100 * time.Millisecond,
-		RumorPeers:    2,
-		ShutdownPeers: 2,
-		TreeMode:      true,
+		GossipTick:     100 * time.Millisecond,
+		RumorPeers:     2,
+		ShutdownPeers:  2,
+		TreeMode:       true,
+		PeerSelection:  RandomSelection,
+		Deadline:       11 * time.Second,
+		GossipDeadline: 10 * time.Second,
+		Linger:         time.Second,
 	}
 }
+
+// check returns an error if the parameters can't be used to run the
+// protocol
+func (params Parameters) check() error {
+	if params.GossipTick <= 0 {
+		return errors.New("gossip tick must be positive")
+	}
+	if params.Deadline < 500*time.Microsecond {
+		return errors.New("unrealistic deadline")
+	}
+	if params.GossipDeadline <= 0 || params.GossipDeadline > params.Deadline {
+		return errors.New("gossip deadline must be positive and before the deadline")
+	}
+	if params.Linger < 0 || params.Linger > params.Deadline {
+		return errors.New("linger must be positive and shorter than the deadline")
+	}
+	if params.ShutdownQuorum < 0 || params.QuietPeriod < 0 {
+		return errors.New("early termination settings must be positive")
+	}
+	if params.FailoverAfter < 0 || params.FailoverAfter > params.GossipDeadline {
+		return errors.New("failover must be positive and before the gossip deadline")
+	}
+	if params.GracePeriod < 0 || params.GracePeriod > params.GossipDeadline {
+		return errors.New("grace period must be positive and before the gossip deadline")
+	}
+	if params.TargetCoverage < 0 || params.TargetCoverage > 100 {
+		return errors.New("target coverage must be a percentage")
+	}
+	if _, err := NewPeerSelector(params.PeerSelection); err != nil {
+		return err
+	}
+	return nil
+}
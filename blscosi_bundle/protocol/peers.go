@@ -0,0 +1,141 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"go.dedis.ch/onet/v3"
+)
+
+// PeerSelection identifies the strategy used to pick the targets of the
+// gossip messages.
+type PeerSelection int
+
+const (
+	// RandomSelection picks a uniform random subset of the peers.
+	RandomSelection PeerSelection = iota
+	// RoundRobinSelection visits every peer once before any peer is repeated.
+	RoundRobinSelection
+	// MissingFirstSelection prefers the peers whose signature is still
+	// missing from the known responses.
+	MissingFirstSelection
+)
+
+var errNotEnoughPeers = errors.New("not enough nodes in the roster")
+
+// PeerSelector chooses the peers that the next gossip messages are sent to.
+// An instance is used by a single protocol instance and may keep state
+// between calls.
+type PeerSelector interface {
+	// SelectPeers returns numTargets distinct nodes among the peers. known is
+	// the participation mask of the responses collected so far.
+	SelectPeers(numTargets int, peers []*onet.TreeNode, known []byte) ([]*onet.TreeNode, error)
+}
+
+// peerState is what a node knows about one of its peers.
+type peerState struct {
+	known       []byte // participation advertised by, or sent to, the peer
+	started     bool   // a rumor has been received from the peer
+	dataSent    bool   // the verification data has been sent to the peer
+	sessionSent bool   // the session and the message have been sent to the peer
+	blacklisted bool   // the peer sent invalid responses
+	shutdown    bool   // the final shutdown has been received from the peer
+}
+
+// NewPeerSelector returns a fresh selector implementing the given strategy.
+func NewPeerSelector(selection PeerSelection) (PeerSelector, error) {
+	switch selection {
+	case RandomSelection:
+		return randomSelector{}, nil
+	case RoundRobinSelection:
+		return &roundRobinSelector{}, nil
+	case MissingFirstSelection:
+		return missingFirstSelector{}, nil
+	default:
+		return nil, fmt.Errorf("unknown peer selection strategy %d", selection)
+	}
+}
+
+// shuffled returns a shuffled copy of the peers.
+func shuffled(peers []*onet.TreeNode) []*onet.TreeNode {
+	res := make([]*onet.TreeNode, len(peers))
+	copy(res, peers)
+	rand.Shuffle(len(res), func(i, j int) { res[i], res[j] = res[j], res[i] })
+	return res
+}
+
+type randomSelector struct{}
+
+func (randomSelector) SelectPeers(numTargets int, peers []*onet.TreeNode, known []byte) ([]*onet.TreeNode, error) {
+	if len(peers) < numTargets {
+		return nil, errNotEnoughPeers
+	}
+	return shuffled(peers)[:numTargets], nil
+}
+
+// roundRobinSelector walks through random permutations of the peers, so that
+// every peer is visited once before any of them is visited again. The queued
+// peers that are not among the given peers anymore, because they have been
+// blacklisted or are done, are skipped.
+type roundRobinSelector struct {
+	queue []*onet.TreeNode
+}
+
+func (s *roundRobinSelector) SelectPeers(numTargets int, peers []*onet.TreeNode, known []byte) ([]*onet.TreeNode, error) {
+	if len(peers) < numTargets {
+		return nil, errNotEnoughPeers
+	}
+
+	results := make([]*onet.TreeNode, 0, numTargets)
+	for len(results) < numTargets {
+		if len(s.queue) == 0 {
+			// Start a new round. The peers already picked in this call are
+			// moved to the back so that no peer is returned twice.
+			var front, back []*onet.TreeNode
+			for _, peer := range shuffled(peers) {
+				if containsNode(results, peer) {
+					back = append(back, peer)
+				} else {
+					front = append(front, peer)
+				}
+			}
+			s.queue = append(front, back...)
+		}
+		peer := s.queue[0]
+		s.queue = s.queue[1:]
+		if containsNode(peers, peer) && !containsNode(results, peer) {
+			results = append(results, peer)
+		}
+	}
+	return results, nil
+}
+
+// missingFirstSelector picks the peers whose bit is not set in the known
+// participation mask first, and completes with random other peers.
+type missingFirstSelector struct{}
+
+func (missingFirstSelector) SelectPeers(numTargets int, peers []*onet.TreeNode, known []byte) ([]*onet.TreeNode, error) {
+	if len(peers) < numTargets {
+		return nil, errNotEnoughPeers
+	}
+
+	var missing, others []*onet.TreeNode
+	for _, peer := range shuffled(peers) {
+		if isBitSet(known, peer.RosterIndex) {
+			others = append(others, peer)
+		} else {
+			missing = append(missing, peer)
+		}
+	}
+	return append(missing, others...)[:numTargets], nil
+}
+
+func containsNode(nodes []*onet.TreeNode, node *onet.TreeNode) bool {
+	for _, n := range nodes {
+		if n.Equal(node) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v3"
+)
+
+var testSuite = pairing.NewSuiteBn256()
+
+func TestPeerSelector_Unknown(t *testing.T) {
+	_, err := NewPeerSelector(PeerSelection(42))
+	require.Error(t, err)
+}
+
+func TestPeerSelector_NotEnoughPeers(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(3, false)
+	peers := tree.Root.Children
+
+	for _, selection := range []PeerSelection{RandomSelection, RoundRobinSelection, MissingFirstSelection} {
+		selector, err := NewPeerSelector(selection)
+		require.NoError(t, err)
+		_, err = selector.SelectPeers(len(peers)+1, peers, nil)
+		require.Error(t, err)
+		targets, err := selector.SelectPeers(len(peers), peers, nil)
+		require.NoError(t, err)
+		require.Len(t, targets, len(peers))
+	}
+}
+
+func TestPeerSelector_RoundRobin(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(6, false)
+	peers := tree.Root.Children
+
+	selector, err := NewPeerSelector(RoundRobinSelection)
+	require.NoError(t, err)
+
+	var picks []*onet.TreeNode
+	for i := 0; i < len(peers); i++ {
+		targets, err := selector.SelectPeers(2, peers, nil)
+		require.NoError(t, err)
+		require.False(t, targets[0].Equal(targets[1]))
+		picks = append(picks, targets...)
+	}
+
+	// Every round visits all the peers exactly once.
+	for round := 0; round < 2; round++ {
+		visited := picks[round*len(peers) : (round+1)*len(peers)]
+		for _, peer := range peers {
+			require.True(t, containsNode(visited, peer))
+		}
+	}
+}
+
+func TestPeerSelector_RoundRobinRemovedPeers(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(6, false)
+	peers := tree.Root.Children
+
+	selector, err := NewPeerSelector(RoundRobinSelection)
+	require.NoError(t, err)
+	_, err = selector.SelectPeers(1, peers, nil)
+	require.NoError(t, err)
+
+	// The peers queued before they were removed are never picked again.
+	removed := peers[1:3]
+	remaining := append([]*onet.TreeNode{peers[0]}, peers[3:]...)
+	for i := 0; i < 2*len(remaining); i++ {
+		targets, err := selector.SelectPeers(2, remaining, nil)
+		require.NoError(t, err)
+		require.Len(t, targets, 2)
+		require.False(t, targets[0].Equal(targets[1]))
+		for _, target := range targets {
+			require.False(t, containsNode(removed, target))
+		}
+	}
+}
+
+func TestPeerSelector_MissingFirst(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(6, false)
+	peers := tree.Root.Children
+
+	selector, err := NewPeerSelector(MissingFirstSelection)
+	require.NoError(t, err)
+
+	// Only the signatures of the nodes 0, 1, 2 and 4 are known.
+	known := []byte{0x17}
+	for i := 0; i < 10; i++ {
+		targets, err := selector.SelectPeers(2, peers, known)
+		require.NoError(t, err)
+		indices := []int{targets[0].RosterIndex, targets[1].RosterIndex}
+		require.Contains(t, indices, 3)
+		require.Contains(t, indices, 5)
+	}
+}
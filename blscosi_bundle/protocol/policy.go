@@ -0,0 +1,48 @@
+package protocol
+
+import "fmt"
+
+// FaultModel identifies how the threshold of a session is derived from the
+// number of nodes n, where f = (n-1)/3 is the number of tolerated faults.
+type FaultModel int
+
+const (
+	// DefaultFaultModel requires n-f signatures, see DefaultThreshold.
+	DefaultFaultModel FaultModel = iota
+	// ByzantineQuorum requires 2f+1 signatures.
+	ByzantineQuorum
+	// MajorityQuorum requires a simple majority of the nodes.
+	MajorityQuorum
+	// ExplicitQuorum requires an explicit number of signatures.
+	ExplicitQuorum
+)
+
+// Policy describes the number of signatures required for a signing session.
+// K is only used with the ExplicitQuorum model.
+type Policy struct {
+	Model FaultModel
+	K     int
+}
+
+// Threshold returns the number of signatures required by the policy among n
+// nodes.
+func (p Policy) Threshold(n int) (int, error) {
+	var threshold int
+	switch p.Model {
+	case DefaultFaultModel:
+		threshold = DefaultThreshold(n)
+	case ByzantineQuorum:
+		threshold = 2*((n-1)/3) + 1
+	case MajorityQuorum:
+		threshold = n/2 + 1
+	case ExplicitQuorum:
+		threshold = p.K
+	default:
+		return 0, fmt.Errorf("unknown fault model %d", p.Model)
+	}
+
+	if threshold < 1 || threshold > n {
+		return 0, fmt.Errorf("threshold of %d is invalid for %d nodes", threshold, n)
+	}
+	return threshold, nil
+}
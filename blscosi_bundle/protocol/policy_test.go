@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Threshold(t *testing.T) {
+	tests := []struct {
+		policy    Policy
+		n         int
+		threshold int
+	}{
+		{Policy{}, 7, 5},
+		{Policy{Model: ByzantineQuorum}, 7, 5},
+		{Policy{Model: ByzantineQuorum}, 9, 5},
+		{Policy{Model: MajorityQuorum}, 7, 4},
+		{Policy{Model: MajorityQuorum}, 8, 5},
+		{Policy{Model: ExplicitQuorum, K: 2}, 7, 2},
+	}
+	for _, test := range tests {
+		threshold, err := test.policy.Threshold(test.n)
+		require.NoError(t, err)
+		require.Equal(t, test.threshold, threshold)
+	}
+
+	_, err := Policy{Model: ExplicitQuorum}.Threshold(7)
+	require.Error(t, err)
+	_, err = Policy{Model: ExplicitQuorum, K: 8}.Threshold(7)
+	require.Error(t, err)
+	_, err = Policy{Model: FaultModel(42)}.Threshold(7)
+	require.Error(t, err)
+}
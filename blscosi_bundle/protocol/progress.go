@@ -0,0 +1,33 @@
+package protocol
+
+// Progress describes the state of a session on a node, as the gossip
+// proceeds.
+type Progress struct {
+	Signers  int  // number of signatures known
+	Refusals int  // number of refusals known
+	Enough   bool // the threshold is reached
+}
+
+// reportProgress sends the progress of the session on the Progress channel,
+// if it changed since the last report. Reports are dropped when the channel
+// is full, so that the protocol never waits for the reader.
+func (p *BlsCosi) reportProgress(responses Responses) {
+	if p.Progress == nil {
+		return
+	}
+
+	progress := Progress{
+		Signers:  responses.Count(),
+		Refusals: len(p.refusals),
+		Enough:   p.isEnough(responses),
+	}
+	if progress == p.lastProgress {
+		return
+	}
+	p.lastProgress = progress
+
+	select {
+	case p.Progress <- progress:
+	default:
+	}
+}
@@ -3,9 +3,9 @@
 package protocol
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	"math/rand"
 	"sync"
 	"time"
 
@@ -17,9 +17,6 @@ import (
 	"go.dedis.ch/onet/v3/log"
 )
 
-const defaultTimeout = 10 * time.Second
-const shutdownAfter = 11 * time.Second // finally truly shutdown the protocol
-
 // VerificationFn is called on every node. Where msg is the message that is
 // co-signed and the data is additional data for verification.
 type VerificationFn func(msg, data []byte) bool
@@ -35,31 +32,53 @@ func init() {
 // This protocol exists on all nodes.
 type BlsCosi struct {
 	*onet.TreeNodeInstance
-	Msg  []byte
-	Data []byte
-	// Timeout is not a global timeout for the protocol, but a timeout used
-	// for waiting for responses.
-	Timeout        time.Duration
-	Threshold      int
-	FinalSignature chan BlsSignature // final signature that is sent back to client
+	Msg            []byte
+	Data           []byte
+	Threshold      int               // in weight units when Weights is set
+	Weights        []int             // weight of each node of the roster, every node weighs one if nil
+	Groups         []Group           // groups of nodes that must each have K signers, if any
+	FinalSignature chan BlsSignature // final signature that is sent back to client, on every node in leaderless mode
+	Improved       chan BlsSignature // final signature with the signatures that arrived after it
+	Aborted        chan error        // reason of the failure when the protocol is aborted
+	// Culprits are the responses dropped from the final signature because
+	// they were invalid. It is set by the aggregating node before the final
+	// signature is sent.
+	Culprits []Culprit
+	// Progress receives the progress of the session when it is not nil. It
+	// must be set before the protocol starts.
+	Progress chan Progress
 
 	stoppedOnce    sync.Once
 	startChan      chan bool
 	verificationFn VerificationFn
-	suite          *pairing.SuiteBn256
+	suite          pairing.Suite
 	Params         Parameters // mainly for simulations
+	session        Session
+	peerSelector   PeerSelector
+	peers          map[onet.TreeNodeID]*peerState
+	rumorRounds    int
+	refusals       map[uint32]*Refusal // verified refusals, by node index
+	lastProgress   Progress
+	checked        BlsSignature // aggregate of the responses last checked
+	checkedMask    []byte       // participation of the responses last checked
 
 	// internodes channels
 	RumorsChan   chan RumorMessage
+	DigestsChan  chan DigestMessage
 	ShutdownChan chan ShutdownMessage
 }
 
 // NewDefaultProtocol is the default protocol function used for registration
-// with an always-true verification.
+// with an always-true verification. It signs with the suite of the node,
+// which must be a pairing suite.
 // Called by GlobalRegisterDefaultProtocols
 func NewDefaultProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	suite, ok := n.Suite().(pairing.Suite)
+	if !ok {
+		return nil, errors.New("the suite of the node is not a pairing suite")
+	}
 	vf := func(a, b []byte) bool { return true }
-	return NewBlsCosi(n, vf, pairing.NewSuiteBn256())
+	return NewBlsCosi(n, vf, suite)
 }
 
 // GlobalRegisterDefaultProtocols is used to register the protocols before use,
@@ -75,20 +94,25 @@ func DefaultThreshold(n int) int {
 	return n - f
 }
 
-// NewBlsCosi method is used to define the blscosi protocol.
-func NewBlsCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite *pairing.SuiteBn256) (onet.ProtocolInstance, error) {
+// NewBlsCosi method is used to define the blscosi protocol. Any pairing
+// suite can be used, as long as the public keys of the roster are points of
+// its G2 group.
+func NewBlsCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite pairing.Suite) (onet.ProtocolInstance, error) {
 	nNodes := len(n.Roster().List)
 	c := &BlsCosi{
 		TreeNodeInstance: n,
 		FinalSignature:   make(chan BlsSignature, 1),
-		Timeout:          defaultTimeout,
+		Improved:         make(chan BlsSignature, 1),
+		Aborted:          make(chan error, 1),
 		Threshold:        DefaultThreshold(nNodes),
 		startChan:        make(chan bool, 1),
 		verificationFn:   vf,
 		suite:            suite,
+		peers:            make(map[onet.TreeNodeID]*peerState),
+		refusals:         make(map[uint32]*Refusal),
 	}
 
-	err := c.RegisterChannels(&c.RumorsChan, &c.ShutdownChan)
+	err := c.RegisterChannels(&c.RumorsChan, &c.DigestsChan, &c.ShutdownChan)
 	if err != nil {
 		return nil, errors.New("couldn't register channels: " + err.Error())
 	}
@@ -101,6 +125,7 @@ func (p *BlsCosi) Shutdown() error {
 	p.stoppedOnce.Do(func() {
 		close(p.startChan)
 		close(p.FinalSignature)
+		close(p.Improved)
 	})
 	return nil
 }
@@ -123,7 +148,9 @@ func (p *BlsCosi) Start() error {
 func (p *BlsCosi) Dispatch() error {
 	defer p.Done()
 
-	protocolTimeout := time.After(shutdownAfter)
+	// Until the session is known, the default deadline is used
+	start := time.Now()
+	deadline := time.After(DefaultParams().Deadline)
 
 	log.Lvlf3("Gossip protocol started at node %v", p.ServerIdentity())
 
@@ -133,8 +160,10 @@ func (p *BlsCosi) Dispatch() error {
 	// stays alive here on this node, but no more rumor messages are sent.
 	shutdown := false
 	done := false
+	// `aborted` is set on the root when the threshold became unreachable.
+	aborted := false
 
-	var rumor *Rumor
+	var rumor *RumorMessage
 
 	// The root must wait for Start() to have been called.
 	if p.IsRoot() {
@@ -146,31 +175,91 @@ func (p *BlsCosi) Dispatch() error {
 		case <-time.After(time.Second):
 			return errors.New("timeout, did you forget to call Start?")
 		}
+		session, err := p.newSession()
+		if err != nil {
+			return err
+		}
+		p.session = session
 	} else {
-		select {
-		case rumorMsg := <-p.RumorsChan:
-			rumor = &rumorMsg.Rumor
-			p.Params = rumor.Params
-			// Copy bytes due to the way protobuf allows the bytes to be
-			// shared with the underlying buffer
-			p.Msg = rumor.Msg[:]
-		case shutdownMsg := <-p.ShutdownChan:
-			p.Params = shutdownMsg.Params
-			p.Msg = shutdownMsg.Msg[:]
-			log.Lvl5("Received shutdown")
-			if err := p.verifyShutdown(shutdownMsg); err == nil {
-				shutdownStruct = shutdownMsg.Shutdown
-				shutdown = true
-			} else {
-				log.Lvl1("Got first spoofed shutdown:", err)
-				// Don't take any action
+		started := false
+		for !started {
+			started = true
+			select {
+			case rumorMsg := <-p.RumorsChan:
+				if rumorMsg.Session.Signature == nil {
+					// A compact rumor of a peer that thinks we know the
+					// session, we ask for a full rumor.
+					log.Lvl5("Received compact rumor before the session")
+					p.SendTo(rumorMsg.TreeNode, &Digest{Reply: true})
+					started = false
+					break
+				}
+				if err := p.verifySession(rumorMsg.Session, rumorMsg.Msg); err != nil {
+					log.Lvl1("Got first rumor with invalid session:", err)
+					started = false
+					break
+				}
+				if err := p.verifyData(rumorMsg.Session, rumorMsg.Data); err != nil {
+					// The data is sent again in the full rumors
+					log.Lvl2("Got first rumor without the data:", err)
+					started = false
+					break
+				}
+				rumor = &rumorMsg
+				p.adoptSession(rumor.Session)
+				// Copy bytes due to the way protobuf allows the bytes to be
+				// shared with the underlying buffer
+				p.Msg = rumor.Msg[:]
+				p.Data = rumor.Data[:]
+			case digestMsg := <-p.DigestsChan:
+				// We can't answer without knowing the message, so we ask
+				// the sender for a full rumor with an empty digest.
+				log.Lvl5("Received digest before the first rumor")
+				p.SendTo(digestMsg.TreeNode, &Digest{Reply: true})
+				started = false
+			case shutdownMsg := <-p.ShutdownChan:
+				if err := p.verifySession(shutdownMsg.Session, shutdownMsg.Msg); err != nil {
+					log.Lvl1("Got first shutdown with invalid session:", err)
+					started = false
+					break
+				}
+				p.adoptSession(shutdownMsg.Session)
+				p.Msg = shutdownMsg.Msg[:]
+				log.Lvl5("Received shutdown")
+				if err := p.verifyShutdown(shutdownMsg); err == nil {
+					shutdownStruct = shutdownMsg.Shutdown
+					p.peer(shutdownMsg.TreeNode).shutdown = true
+					shutdown = true
+				} else {
+					log.Lvl1("Got first spoofed shutdown:", err)
+					// Don't take any action
+				}
+			case <-deadline:
+				log.Lvl2(p.ServerIdentity(), "never heard of the session")
+				return nil
 			}
-		case <-protocolTimeout:
-			shutdown = true
-			done = true
 		}
 	}
 
+	deadline = time.After(time.Until(start.Add(p.Params.Deadline)))
+	gossipDeadline := time.After(time.Until(start.Add(p.Params.GossipDeadline)))
+	// `finalizer` is set on the nodes allowed to aggregate the signature: the
+	// root, and the other nodes once the root is late or in leaderless mode.
+	finalizer := p.IsRoot() || p.Params.Leaderless
+	// `grace` fires at the end of the grace period once the threshold is
+	// reached.
+	var grace <-chan time.Time
+	var failover <-chan time.Time
+	if !p.IsRoot() && p.Params.FailoverAfter > 0 {
+		failover = time.After(time.Until(start.Add(p.Params.FailoverAfter)))
+	}
+
+	selector, err := NewPeerSelector(p.Params.PeerSelection)
+	if err != nil {
+		return err
+	}
+	p.peerSelector = selector
+
 	// responses is a map where we collect all signatures.
 	var responses Responses
 	if p.Params.TreeMode {
@@ -185,41 +274,71 @@ func (p *BlsCosi) Dispatch() error {
 	}
 
 	// Add own signature.
-	err := p.trySign(responses)
+	err = p.trySign(responses)
 	if err != nil {
 		return err
 	}
 
 	if rumor != nil {
-		err = responses.Update(rumor.ResponseMap)
+		err = p.mergeRumor(responses, *rumor)
 		if err != nil {
 			return err
 		}
 		log.Lvlf5("Incoming first rumor, %d known, %d needed",
 			responses.Count(), p.Threshold)
 	}
+	p.reportProgress(responses)
+	if p.IsRoot() && p.isRefusalQuorum() {
+		shutdown = true
+		aborted = true
+	}
 
 	ticker := time.NewTicker(p.Params.GossipTick)
 	for !shutdown {
 		select {
 		case rumor := <-p.RumorsChan:
-			err = responses.Update(rumor.ResponseMap)
+			if !p.isRumorSession(rumor.Rumor) {
+				log.Lvl1("Ignoring rumor of another session")
+				break
+			}
+			err = p.mergeRumor(responses, rumor)
 			if err != nil {
 				return err
 			}
-			log.Lvlf5("Incoming rumor, %d known, %d needed, is-root %v",
-				responses.Count(), p.Threshold, p.IsRoot())
-			if p.IsRoot() && p.isEnough(responses) {
+			log.Lvlf5("Incoming rumor, %d known, %d refused, %d needed, is-root %v",
+				responses.Count(), len(p.refusals), p.Threshold, p.IsRoot())
+			p.reportProgress(responses)
+			if finalizer && p.isEnough(responses) {
 				// We've got all the signatures.
 				//res := responses.(TreeResponses)
 				//log.Lvl5("Got all the signatures",
 				//	res.mask.CountEnabled(), res.responses, res.mask.Mask())
+				if grace == nil && p.Params.GracePeriod > 0 {
+					log.Lvl3("Threshold reached, collecting more signatures")
+					grace = time.After(p.Params.GracePeriod)
+				}
+				if p.Params.GracePeriod == 0 || p.isCovered(responses) {
+					// The gossip goes on if some signatures were invalid
+					shutdown, err = p.checkEnough(responses)
+					if err != nil {
+						return err
+					}
+				}
+			} else if p.IsRoot() && p.isRefusalQuorum() {
+				log.Lvl2("A quorum refused, aborting")
 				shutdown = true
+				aborted = true
+			}
+		case digestMsg := <-p.DigestsChan:
+			log.Lvl5("Incoming digest")
+			if !p.peer(digestMsg.TreeNode).blacklisted {
+				p.answerDigest(digestMsg, responses)
 			}
 		case shutdownMsg := <-p.ShutdownChan:
 			log.Lvl5("Received shutdown")
 			if err := p.verifyShutdown(shutdownMsg); err == nil {
 				shutdownStruct = shutdownMsg.Shutdown
+				p.peer(shutdownMsg.TreeNode).shutdown = true
 				shutdown = true
 			} else {
 				log.Lvl1("Got spoofed shutdown:", err)
@@ -227,9 +346,34 @@ func (p *BlsCosi) Dispatch() error {
 				// Don't take any action
 			}
 		case <-ticker.C:
-			log.Lvl5("Outgoing rumor")
-			p.sendRumors(responses)
-		case <-protocolTimeout:
+			if p.Params.PushPull {
+				log.Lvl5("Outgoing digest")
+				p.sendDigests(responses)
+			} else {
+				log.Lvl5("Outgoing rumor")
+				p.sendRumors(responses)
+			}
+		case <-failover:
+			log.Lvl2(p.ServerIdentity(), "didn't get the shutdown in time, taking over")
+			finalizer = true
+			if p.isEnough(responses) {
+				shutdown, err = p.checkEnough(responses)
+				if err != nil {
+					return err
+				}
+			}
+		case <-grace:
+			shutdown, err = p.checkEnough(responses)
+			if err != nil {
+				return err
+			}
+			if !shutdown {
+				log.Lvl2("Not enough valid signatures at the end of the grace period")
+				grace = nil
+			}
+		case <-gossipDeadline:
+			shutdown = true
+		case <-deadline:
 			shutdown = true
 			done = true
 		}
@@ -237,49 +381,133 @@ func (p *BlsCosi) Dispatch() error {
 	log.Lvl5("Done with gossiping")
 	ticker.Stop()
 
-	if p.IsRoot() {
-		log.Lvl3(p.ServerIdentity().Address, "collected all signature responses")
-
-		log.Lvlf3("%v is aggregating signatures", p.ServerIdentity())
-		// generate root signature
-		signaturePoint, finalMask, err := responses.Aggregate(p.suite, p.Publics())
+	// The shutdown is only set when it has been received
+	received := p.isSession(shutdownStruct.Session)
+	if !p.IsRoot() && finalizer && !received && p.isEnough(responses) {
+		// The gossip may have stopped at the deadline: the invalid
+		// signatures are dropped so that another node than the root only
+		// finalizes a signature fulfilling the policy
+		_, err = p.checkEnough(responses)
 		if err != nil {
 			return err
 		}
+	}
 
-		signature, err := signaturePoint.MarshalBinary()
+	// Without a quorum of refusals, the root still aborts at the gossip
+	// deadline once the threshold is unreachable
+	if p.IsRoot() && !aborted && !received && p.isUnreachable() {
+		aborted = true
+	}
+
+	// `finalized` is set when this node aggregated the final signature, out
+	// of `finalCount` signatures.
+	finalized := false
+	finalCount := 0
+	if p.IsRoot() && aborted {
+		err := p.reportAbort()
 		if err != nil {
 			return err
 		}
+		shutdownStruct = Shutdown{p.session, nil, nil, p.Msg, p.refusals, 0}
+	} else if !received && (p.IsRoot() || (finalizer && p.isEnough(responses))) {
+		log.Lvl3(p.ServerIdentity().Address, "collected all signature responses")
 
-		finalSig := append(signature, finalMask.Mask()...)
-		log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), signature, finalMask.Mask())
+		log.Lvlf3("%v is aggregating signatures", p.ServerIdentity())
+		// generate root signature
+		finalSig, culprits, err := p.finalAggregate(responses)
+		if err != nil {
+			return err
+		}
+		p.Culprits = append(p.Culprits, culprits...)
 		p.FinalSignature <- finalSig
+		finalized = true
+		finalCount = responses.Count()
 
 		// Sign shutdown message
 		rootSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
 		if err != nil {
 			return err
 		}
-		shutdownStruct = Shutdown{p.Params, finalSig, rootSig, p.Msg}
+		index := uint32(p.TreeNode().RosterIndex)
+		shutdownStruct = Shutdown{p.session, finalSig, rootSig, p.Msg, nil, index}
+	} else if p.IsRoot() && received && shutdownStruct.FinalCoSignature == nil {
+		// Another node aborted the session in our place
+		err := p.reportAbort()
+		if err != nil {
+			return err
+		}
+	} else if (p.IsRoot() || p.Params.Leaderless) && received {
+		// Another node finalized the session in our place, the final
+		// signature of its shutdown is as good as ours
+		p.FinalSignature <- shutdownStruct.FinalCoSignature
 	}
 
-	p.sendShutdowns(shutdownStruct)
+	// Nodes that stopped at the gossip deadline have no shutdown to forward
+	hasShutdown := p.isSession(shutdownStruct.Session)
+	if hasShutdown {
+		p.sendShutdowns(shutdownStruct)
+	}
 
 	// We respond to every non-shutdown message with a shutdown message, to
 	// ensure that all nodes will shut down eventually. This is also the reason
-	// why we don't immediately do a hard shutdown.
-	for !done {
+	// why we don't immediately do a hard shutdown. The node terminates early
+	// when the shutdown is known to have spread, or when nobody talks to it
+	// anymore.
+	linger := time.After(p.Params.Linger)
+	var quiet <-chan time.Time
+	if p.Params.QuietPeriod > 0 {
+		quiet = time.After(p.Params.QuietPeriod)
+	}
+	for !done && !p.isShutdownSpread() {
 		select {
 		case rumor := <-p.RumorsChan:
 			sender := rumor.TreeNode
 			log.Lvl5("Responding to rumor with shutdown", sender.Equal(p.TreeNode()))
-			p.sendShutdown(sender, shutdownStruct)
-		case <-p.ShutdownChan:
-			// ignore
-		case <-protocolTimeout:
+			if hasShutdown {
+				p.sendShutdown(sender, shutdownStruct)
+			}
+			if finalized && p.isRumorSession(rumor.Rumor) {
+				// Late signatures can still improve the final signature
+				err = p.mergeRumor(responses, rumor)
+				if err != nil {
+					return err
+				}
+			}
+			if p.Params.QuietPeriod > 0 {
+				quiet = time.After(p.Params.QuietPeriod)
+			}
+		case digest := <-p.DigestsChan:
+			log.Lvl5("Responding to digest with shutdown")
+			if hasShutdown {
+				p.sendShutdown(digest.TreeNode, shutdownStruct)
+			}
+			if p.Params.QuietPeriod > 0 {
+				quiet = time.After(p.Params.QuietPeriod)
+			}
+		case shutdownMsg := <-p.ShutdownChan:
+			// Only the shutdown we know counts, there is no need to verify
+			// it again
+			if hasShutdown && p.isSession(shutdownMsg.Session) &&
+				bytes.Equal(shutdownMsg.FinalCoSignature, shutdownStruct.FinalCoSignature) {
+				p.peer(shutdownMsg.TreeNode).shutdown = true
+			}
+		case <-quiet:
+			log.Lvl5("Terminating after the quiet period")
+			done = true
+		case <-linger:
 			done = true
+		case <-deadline:
+			done = true
+		}
+	}
+	if finalized && responses.Count() > finalCount {
+		improved, _, err := p.aggregate(responses)
+		if err != nil {
+			return err
 		}
+		log.Lvlf3("%v improved the final signature from %d to %d signers",
+			p.ServerIdentity(), finalCount, responses.Count())
+		p.Improved <- improved
 	}
 	log.Lvl5("Done with the whole protocol")
 
@@ -289,6 +517,11 @@ func (p *BlsCosi) Dispatch() error {
 func (p *BlsCosi) trySign(responses Responses) error {
 	if !p.verificationFn(p.Msg, p.Data) {
 		log.Lvlf4("Node %v refused to sign", p.ServerIdentity())
+		refusal, err := p.makeRefusal()
+		if err != nil {
+			return err
+		}
+		p.refusals[uint32(p.TreeNode().RosterIndex)] = refusal
 		return nil
 	}
 	own, idx, err := p.makeResponse()
@@ -302,25 +535,133 @@ func (p *BlsCosi) trySign(responses Responses) error {
 
 // sendRumors sends a rumor message to some peers.
 func (p *BlsCosi) sendRumors(responses Responses) {
-	targets, err := p.getRandomPeers(p.Params.RumorPeers)
+	targets, err := p.selectPeers(p.Params.RumorPeers, responses.Participation())
+	if err != nil {
+		log.Lvl1("Couldn't get peers:", err)
+		return
+	}
+	// In delta mode, a full rumor is still sent periodically in case
+	// previous rumors were lost.
+	full := !p.Params.DeltaRumors ||
+		(p.Params.FullRumorPeriod > 0 && p.rumorRounds%p.Params.FullRumorPeriod == 0)
+	p.rumorRounds++
+
+	log.Lvl5("Sending rumors, full:", full)
+	for _, target := range targets {
+		p.sendRumor(target, responses, full)
+	}
+}
+
+// sendRumor sends the given signatures to a peer. Unless full is true, only
+// the signatures that the peer is not known to have are sent.
+func (p *BlsCosi) sendRumor(target *onet.TreeNode, responses Responses, full bool) {
+	state := p.peer(target)
+	responseMap := responses.Map()
+	if !full {
+		responseMap = missingResponses(responseMap, state.known)
+	}
+	participation := responses.Participation()
+	state.known = orMasks(state.known, participation)
+	p.SendTo(target, p.newRumor(state, responseMap, participation, p.dataFor(state, full)))
+}
+
+// sendDigests sends our participation mask to some peers, which will reply
+// with the signatures that we lack.
+func (p *BlsCosi) sendDigests(responses Responses) {
+	participation := responses.Participation()
+	targets, err := p.selectPeers(p.Params.RumorPeers, participation)
 	if err != nil {
-		log.Lvl1("Couldn't get random peers:", err)
+		log.Lvl1("Couldn't get peers:", err)
 		return
 	}
-	log.Lvl5("Sending rumors")
+	log.Lvl5("Sending digests")
 	for _, target := range targets {
-		p.sendRumor(target, responses)
+		p.SendTo(target, &Digest{Participation: participation, Refused: p.refusalMask()})
 	}
 }
 
-// sendRumor sends the given signatures to a random peer.
-func (p *BlsCosi) sendRumor(target *onet.TreeNode, responses Responses) {
-	p.SendTo(target, &Rumor{p.Params, responses.Map(), p.Msg})
+// answerDigest replies to a digest with a rumor holding the signatures that
+// its sender lacks. If the sender knows signatures that we lack, we also
+// send back our own digest.
+func (p *BlsCosi) answerDigest(msg DigestMessage, responses Responses) {
+	state := p.peer(msg.TreeNode)
+	state.known = orMasks(state.known, msg.Participation)
+	participation := responses.Participation()
+	refused := p.refusalMask()
+
+	// An empty digest comes from a node that has not started yet
+	empty := len(msg.Participation) == 0
+	missing := missingResponses(responses.Map(), msg.Participation)
+	if len(missing) > 0 || empty || !isSubset(refused, msg.Refused) {
+		state.known = orMasks(state.known, participation)
+		var data []byte
+		if empty {
+			data = p.Data
+			state.sessionSent = false
+		}
+		p.SendTo(msg.TreeNode, p.newRumor(state, missing, participation, data))
+	}
+
+	if !msg.Reply && (!isSubset(msg.Participation, participation) || !isSubset(msg.Refused, refused)) {
+		p.SendTo(msg.TreeNode, &Digest{Participation: participation, Refused: refused, Reply: true})
+	}
+}
+
+// peer returns the state of the given peer.
+func (p *BlsCosi) peer(node *onet.TreeNode) *peerState {
+	state, ok := p.peers[node.ID]
+	if !ok {
+		state = &peerState{}
+		p.peers[node.ID] = state
+	}
+	return state
+}
+
+// isShutdownSpread returns true when enough peers sent us the shutdown, so
+// that the node doesn't need to forward it anymore.
+func (p *BlsCosi) isShutdownSpread() bool {
+	if p.Params.ShutdownQuorum == 0 {
+		return false
+	}
+	count := 0
+	for _, state := range p.peers {
+		if state.shutdown {
+			count++
+		}
+	}
+	return count >= p.Params.ShutdownQuorum
+}
+
+// learnRumor records what the sender of the rumor knows.
+func (p *BlsCosi) learnRumor(rumor RumorMessage) {
+	if rumor.TreeNode == nil {
+		return
+	}
+	state := p.peer(rumor.TreeNode)
+	state.known = orMasks(state.known, rumor.Participation)
+	state.started = true
+}
+
+// dataFor returns the verification data to attach to a rumor for the peer.
+// It is sent once to the peers that may not have started yet, and again in
+// full rumors in case it got lost.
+func (p *BlsCosi) dataFor(state *peerState, full bool) []byte {
+	if state.started || (state.dataSent && !full) {
+		return nil
+	}
+	state.dataSent = true
+	return p.Data
 }
 
 // sendShutdowns sends a shutdown message to some random peers.
 func (p *BlsCosi) sendShutdowns(shutdown Shutdown) {
-	targets, err := p.getRandomPeers(p.Params.ShutdownPeers)
+	peers := p.getPeers()
+	numTargets := p.Params.ShutdownPeers
+	if numTargets > len(peers) {
+		// the other peers are done already
+		numTargets = len(peers)
+	}
+	targets, err := randomSelector{}.SelectPeers(numTargets, peers, nil)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers for shutdown:", err)
 		return
@@ -341,17 +682,31 @@ func (p *BlsCosi) verifyShutdown(msg ShutdownMessage) error {
 	if len(p.Publics()) == 0 {
 		return errors.New("Roster is empty")
 	}
-	rootPublic := p.Publics()[0]
+	if !p.isSession(msg.Session) {
+		return errors.New("shutdown of another session")
+	}
+	if msg.FinalCoSignature == nil {
+		// The protocol has been aborted, the refusals are the proof
+		p.updateRefusals(msg.Refusals)
+		if !p.isUnreachable() {
+			return errors.New("not enough valid refusals to abort")
+		}
+		return nil
+	}
+	if int(msg.Finalizer) >= len(p.Publics()) {
+		return errors.New("unknown finalizer")
+	}
+	finalizerPublic := p.Publics()[msg.Finalizer]
 	finalSig := msg.FinalCoSignature
 
-	// verify final signature
-	err := msg.FinalCoSignature.VerifyAggregate(p.suite, p.Msg, p.Publics())
+	// verify final signature with the threshold of the session
+	err := msg.FinalCoSignature.VerifyAggregateWithPolicy(p.suite, p.statement(), p.Publics(), p.policy())
 	if err != nil {
 		return err
 	}
 
-	// verify root signature of final signature
-	return verify(p.suite, msg.RootSig, finalSig, rootPublic)
+	// verify the signature of the finalizer on the final signature
+	return verify(p.suite, msg.RootSig, finalSig, finalizerPublic)
 }
 
 // verify checks the signature over the message with a single key
@@ -371,49 +726,48 @@ func verify(suite pairing.Suite, sig []byte, msg []byte, public kyber.Point) err
 
 // isEnough returns true if we have enough responses.
 func (p *BlsCosi) isEnough(responses Responses) bool {
-	return responses.Count() >= p.Threshold
+	participation := responses.Participation()
+	return p.weight(participation) >= p.Threshold && groupsSatisfied(participation, p.Groups)
 }
 
-// getRandomPeers returns a slice of random peers (not including self).
-func (p *BlsCosi) getRandomPeers(numTargets int) ([]*onet.TreeNode, error) {
-	self := p.TreeNode()
-	root := p.Root()
-	allNodes := append(root.Children, root)
-
-	numPeers := len(allNodes) - 1
-
-	selfIndex := len(allNodes)
-	for i, node := range allNodes {
-		if node.Equal(self) {
-			selfIndex = i
-			break
-		}
-	}
-	if selfIndex == len(allNodes) {
-		log.Lvl1("couldn't find outselves in the roster")
-		numPeers++
+// isCovered returns true when the signatures of the target coverage, or of
+// every node, are known.
+func (p *BlsCosi) isCovered(responses Responses) bool {
+	if responses.Count() >= len(p.Publics()) {
+		return true
 	}
+	weight := p.weight(responses.Participation())
+	return p.Params.TargetCoverage > 0 && weight*100 >= p.Params.TargetCoverage*p.totalWeight()
+}
 
-	if numPeers < numTargets {
-		return nil, errors.New("not enough nodes in the roster")
+// selectPeers selects numTargets peers with the selector of the protocol.
+// Once peers are blacklisted or done, fewer may remain in a small roster, and
+// they are all selected.
+func (p *BlsCosi) selectPeers(numTargets int, known []byte) ([]*onet.TreeNode, error) {
+	peers := p.getPeers()
+	if numTargets > len(peers) {
+		numTargets = len(peers)
 	}
+	return p.peerSelector.SelectPeers(numTargets, peers, known)
+}
 
-	arr := make([]int, numPeers)
-	for i := range arr {
-		arr[i] = i
-	}
-	rand.Shuffle(len(arr), func(i, j int) { arr[i], arr[j] = arr[j], arr[i] })
+// getPeers returns all the nodes of the tree except self, the blacklisted
+// ones and the ones that already sent us the shutdown.
+func (p *BlsCosi) getPeers() []*onet.TreeNode {
+	self := p.TreeNode()
+	root := p.Root()
+	allNodes := append([]*onet.TreeNode{root}, root.Children...)
 
-	results := make([]*onet.TreeNode, numTargets)
-	for i := range results {
-		index := arr[i]
-		if index >= selfIndex {
-			index++
+	peers := make([]*onet.TreeNode, 0, len(allNodes))
+	for _, node := range allNodes {
+		if node.Equal(self) {
+			continue
+		}
+		if state := p.peer(node); !state.blacklisted && !state.shutdown {
+			peers = append(peers, node)
 		}
-		results[i] = allNodes[index]
 	}
-
-	return results, nil
+	return peers
 }
 
 // checkIntegrity checks if the protocol has been instantiated with
@@ -428,23 +782,29 @@ func (p *BlsCosi) checkIntegrity() error {
 	if p.verificationFn == nil {
 		return fmt.Errorf("verification function cannot be nil")
 	}
-	if p.Timeout < 500*time.Microsecond {
-		return fmt.Errorf("unrealistic timeout")
+	if err := checkWeights(p.Weights, p.Tree().Size()); err != nil {
+		return err
 	}
-	if p.Threshold > p.Tree().Size() {
-		return fmt.Errorf("threshold (%d) bigger than number of nodes (%d)", p.Threshold, p.Tree().Size())
+	if p.Threshold > p.totalWeight() {
+		return fmt.Errorf("threshold (%d) bigger than the weight of the nodes (%d)", p.Threshold, p.totalWeight())
 	}
 	if p.Threshold < 1 {
 		return fmt.Errorf("threshold of %d smaller than one node", p.Threshold)
 	}
+	if err := checkGroups(p.Groups, p.Tree().Size()); err != nil {
+		return err
+	}
+	if err := p.Params.check(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
-// checkFailureThreshold returns true when the number of failures
+// checkFailureThreshold returns true when the weight of the failures
 // is above the threshold
-func (p *BlsCosi) checkFailureThreshold(numFailure int) bool {
-	return numFailure > len(p.Roster().List)-p.Threshold
+func (p *BlsCosi) checkFailureThreshold(failureWeight int) bool {
+	return failureWeight > p.totalWeight()-p.Threshold
 }
 
 // Sign the message and pack it with the mask as a response
@@ -461,7 +821,7 @@ func (p *BlsCosi) makeResponse() (*Response, int, error) {
 		return nil, 0, errors.New("Couldn't find own index")
 	}
 
-	sig, err := bdn.Sign(p.suite, p.Private(), p.Msg)
+	sig, err := bdn.Sign(p.suite, p.Private(), p.statement())
 	if err != nil {
 		return nil, 0, err
 	}
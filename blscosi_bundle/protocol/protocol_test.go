@@ -0,0 +1,517 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/group/edwards25519"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+const refusingProtocolName = "bundleCoSiRefusing"
+const dataProtocolName = "bundleCoSiData"
+const fewRefusingProtocolName = "bundleCoSiFewRefusing"
+
+var testData = []byte("verification data")
+
+var testTimeout = 20 * time.Second
+
+func init() {
+	onet.GlobalProtocolRegister(refusingProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		vf := func(a, b []byte) bool { return false }
+		return NewBlsCosi(n, vf, testSuite)
+	})
+	onet.GlobalProtocolRegister(dataProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		vf := func(msg, data []byte) bool { return bytes.Equal(data, testData) }
+		return NewBlsCosi(n, vf, testSuite)
+	})
+	// The nodes of odd index refuse
+	onet.GlobalProtocolRegister(fewRefusingProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		accept := n.TreeNode().RosterIndex%2 == 0
+		vf := func(msg, data []byte) bool { return accept }
+		return NewBlsCosi(n, vf, testSuite)
+	})
+}
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+// newRootProtocol creates the protocol on the root of a new tree and returns
+// the root instance, ready to be started.
+func newRootProtocol(t *testing.T, local *onet.LocalTest, name string, nbrNodes int, params Parameters) (*BlsCosi, *onet.Tree) {
+	_, _, tree := local.GenTree(nbrNodes, false)
+	pi, err := local.CreateProtocol(name, tree)
+	require.NoError(t, err)
+
+	p := pi.(*BlsCosi)
+	p.Msg = []byte("hello bundle protocol")
+	p.Params = params
+	return p, tree
+}
+
+// waitResult waits for the final signature or the abort of the protocol.
+func waitResult(p *BlsCosi) (BlsSignature, error) {
+	select {
+	case sig := <-p.FinalSignature:
+		return sig, nil
+	case err := <-p.Aborted:
+		return nil, err
+	case <-time.After(testTimeout):
+		return nil, errors.New("didn't get the result in time")
+	}
+}
+
+func TestProtocol_Sign(t *testing.T) {
+	pushPull := DefaultParams()
+	pushPull.PushPull = true
+	delta := DefaultParams()
+	delta.DeltaRumors = true
+	delta.FullRumorPeriod = 10
+	verified := DefaultParams()
+	verified.VerifyResponses = true
+	verified.BatchVerify = true
+	for _, params := range []Parameters{DefaultParams(), pushPull, delta, verified} {
+		local := onet.NewLocalTest(testSuite)
+		p, tree := newRootProtocol(t, local, DefaultProtocolName, 7, params)
+		require.NoError(t, p.Start())
+
+		sig, err := waitResult(p)
+		require.NoError(t, err)
+		require.NoError(t, sig.VerifyAggregate(testSuite, p.Msg, tree.Roster.Publics()))
+		local.CloseAll()
+	}
+}
+
+func TestProtocol_CompactRumors(t *testing.T) {
+	for _, pushPull := range []bool{false, true} {
+		local := onet.NewLocalTest(testSuite)
+		params := DefaultParams()
+		params.CompactRumors = true
+		params.PushPull = pushPull
+		params.TreeMode = !pushPull
+		p, tree := newRootProtocol(t, local, DefaultProtocolName, 7, params)
+		require.NoError(t, p.Start())
+
+		sig, err := waitResult(p)
+		require.NoError(t, err)
+		require.NoError(t, sig.VerifyAggregate(testSuite, p.Msg, tree.Roster.Publics()))
+		local.CloseAll()
+	}
+}
+
+func TestProtocol_BindSession(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	params := DefaultParams()
+	params.BindSession = true
+	p, tree := newRootProtocol(t, local, DefaultProtocolName, 7, params)
+	require.NoError(t, p.Start())
+
+	sig, err := waitResult(p)
+	require.NoError(t, err)
+	publics := tree.Roster.Publics()
+	policy := p.policy()
+	ctx := p.SigningContext()
+	require.NotNil(t, ctx)
+	require.NoError(t, sig.VerifyAggregateInContext(testSuite, ctx, p.Msg, publics, policy))
+
+	// The signature is only valid in its context
+	require.Error(t, sig.VerifyAggregate(testSuite, p.Msg, publics))
+	other := *ctx
+	other.Nonce = make([]byte, nonceSize)
+	require.Error(t, sig.VerifyAggregateInContext(testSuite, &other, p.Msg, publics, policy))
+	other = *ctx
+	other.RosterID = onet.RosterID{}
+	require.Error(t, sig.VerifyAggregateInContext(testSuite, &other, p.Msg, publics, policy))
+}
+
+func TestProtocol_Suite(t *testing.T) {
+	// The default protocol signs with the suite of the nodes
+	local := onet.NewLocalTest(testSuite)
+	p, tree := newRootProtocol(t, local, DefaultProtocolName, 5, DefaultParams())
+	require.NoError(t, p.Start())
+
+	sig, err := waitResult(p)
+	require.NoError(t, err)
+	require.NoError(t, sig.VerifyAggregate(testSuite, p.Msg, tree.Roster.Publics()))
+	local.CloseAll()
+
+	// which must be a pairing suite
+	local = onet.NewLocalTest(edwards25519.NewBlakeSHA256Ed25519())
+	defer local.CloseAll()
+	_, _, tree = local.GenTree(3, false)
+	_, err = local.CreateProtocol(DefaultProtocolName, tree)
+	require.Error(t, err)
+}
+
+func TestProtocol_Refusals(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	p, tree := newRootProtocol(t, local, refusingProtocolName, 7, DefaultParams())
+	require.NoError(t, p.Start())
+
+	start := time.Now()
+	_, err := waitResult(p)
+	require.Error(t, err)
+	require.IsType(t, &ThresholdUnreachableError{}, err)
+	require.True(t, time.Since(start) < p.Params.GossipDeadline)
+
+	// The refusal certificate is made by a quorum, and can't be mistaken
+	// for a signature
+	certificate := err.(*ThresholdUnreachableError).Certificate
+	publics := tree.Roster.Publics()
+	mask, err := certificate.GetMask(testSuite, publics)
+	require.NoError(t, err)
+	require.True(t, mask.CountEnabled() >= p.Threshold)
+	require.NoError(t, certificate.VerifyRefusal(testSuite, p.Msg, publics))
+	require.Error(t, certificate.VerifyAggregate(testSuite, p.Msg, publics))
+	require.Error(t, certificate.VerifyRefusal(testSuite, []byte("another message"), publics))
+}
+
+func TestProtocol_RefusalsWithoutQuorum(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	params := DefaultParams()
+	params.GossipDeadline = 2 * time.Second
+	params.Deadline = 3 * time.Second
+	p, _ := newRootProtocol(t, local, fewRefusingProtocolName, 7, params)
+	require.NoError(t, p.Start())
+
+	// Three refusals make the threshold of five unreachable, but they are
+	// no quorum, so the root aborts at the gossip deadline without a
+	// certificate
+	start := time.Now()
+	_, err := waitResult(p)
+	require.IsType(t, &ThresholdUnreachableError{}, err)
+	require.True(t, time.Since(start) >= params.GossipDeadline)
+	require.Equal(t, 3, err.(*ThresholdUnreachableError).Refusals)
+	require.Nil(t, err.(*ThresholdUnreachableError).Certificate)
+}
+
+func TestProtocol_Data(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	p, tree := newRootProtocol(t, local, dataProtocolName, 7, DefaultParams())
+	p.Data = testData
+	require.NoError(t, p.Start())
+
+	// Every node must have received the data to accept the message
+	sig, err := waitResult(p)
+	require.NoError(t, err)
+	mask, err := sig.GetMask(testSuite, tree.Roster.Publics())
+	require.NoError(t, err)
+	require.True(t, mask.CountEnabled() >= p.Threshold)
+
+	local2 := onet.NewLocalTest(testSuite)
+	defer local2.CloseAll()
+	p, _ = newRootProtocol(t, local2, dataProtocolName, 7, DefaultParams())
+	require.NoError(t, p.Start())
+	_, err = waitResult(p)
+	require.IsType(t, &ThresholdUnreachableError{}, err)
+}
+
+func TestProtocol_Session(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	p, _ := newRootProtocol(t, local, DefaultProtocolName, 3, DefaultParams())
+
+	session, err := p.newSession()
+	require.NoError(t, err)
+	require.NoError(t, p.verifySession(session, p.Msg))
+	require.Error(t, p.verifySession(session, []byte("another message")))
+
+	// Parameters can't be injected
+	forged := session
+	forged.Params.GossipTick = time.Nanosecond
+	require.Error(t, p.verifySession(forged, p.Msg))
+
+	forged = session
+	forged.Threshold = 1
+	require.Error(t, p.verifySession(forged, p.Msg))
+
+	forged = session
+	forged.RosterID = onet.RosterID{}
+	require.Error(t, p.verifySession(forged, p.Msg))
+
+	// The verification data is bound to the session
+	require.NoError(t, p.verifyData(session, p.Data))
+	require.Error(t, p.verifyData(session, []byte("another data")))
+	forged = session
+	forged.DataHash = p.hashMsg([]byte("another data"))
+	require.Error(t, p.verifySession(forged, p.Msg))
+
+	// Any node of the roster can lead a session, but only for a tree rooted
+	// at itself
+	roster := p.Roster()
+	root := onet.NewTreeNode(1, roster.List[1])
+	for i, si := range roster.List {
+		if i != 1 {
+			root.AddChild(onet.NewTreeNode(i, si))
+		}
+	}
+	pi, err := local.CreateProtocol(DefaultProtocolName, onet.NewTree(roster, root))
+	require.NoError(t, err)
+	leader := pi.(*BlsCosi)
+	leader.Msg = p.Msg
+	leader.Params = DefaultParams()
+	other, err := leader.newSession()
+	require.NoError(t, err)
+	require.NoError(t, leader.verifySession(other, p.Msg))
+	require.Error(t, p.verifySession(other, p.Msg))
+	require.Error(t, leader.verifySession(session, p.Msg))
+}
+
+func TestProtocol_VerifyResponses(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	params := DefaultParams()
+	params.VerifyResponses = true
+	params.BatchVerify = true
+	p, _ := newRootProtocol(t, local, DefaultProtocolName, 3, params)
+
+	own, idx, err := p.makeResponse()
+	require.NoError(t, err)
+
+	// Responses are already aggregated in tree mode
+	sender, err := NewTreeResponses(p.suite, p.Publics())
+	require.NoError(t, err)
+	require.NoError(t, sender.Add(idx, own))
+	receiver, err := NewTreeResponses(p.suite, p.Publics())
+	require.NoError(t, err)
+	valid, err := p.verifyResponses(receiver, sender.Map())
+	require.NoError(t, err)
+	require.Len(t, valid, 1)
+
+	// A signature of another message is rejected
+	forged, err := bdn.Sign(p.suite, p.Private(), []byte("another message"))
+	require.NoError(t, err)
+	_, err = p.verifyResponses(make(SimpleResponses),
+		map[uint32](*Response){uint32(idx): {Signature: forged, Mask: own.Mask}})
+	require.Error(t, err)
+
+	// A response stored at the wrong index is rejected
+	_, err = p.verifyResponses(make(SimpleResponses),
+		map[uint32](*Response){uint32(idx + 1): own})
+	require.Error(t, err)
+}
+
+func TestProtocol_BlacklistSmallRoster(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	params := DefaultParams()
+	params.VerifyResponses = true
+	p, _ := newRootProtocol(t, local, DefaultProtocolName, 3, params)
+	require.Equal(t, 2, p.Params.RumorPeers)
+
+	// One of the two peers sends an invalid signature
+	peers := p.getPeers()
+	require.Len(t, peers, 2)
+	bad, honest := peers[0], peers[1]
+	forged, err := bdn.Sign(p.suite, p.Private(), p.statement())
+	require.NoError(t, err)
+	mask := make([]byte, 1)
+	mask[0] = 1 << uint(bad.RosterIndex)
+	rumor := Rumor{ResponseMap: map[uint32](*Response){uint32(bad.RosterIndex): {Signature: forged, Mask: mask}}}
+	require.NoError(t, p.mergeRumor(make(SimpleResponses), RumorMessage{bad, rumor}))
+	require.True(t, p.peer(bad).blacklisted)
+
+	// The remaining peer still gets the rumors, though there are fewer
+	// peers than RumorPeers
+	p.peerSelector, err = NewPeerSelector(params.PeerSelection)
+	require.NoError(t, err)
+	targets, err := p.selectPeers(p.Params.RumorPeers, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*onet.TreeNode{honest}, targets)
+}
+
+func TestProtocol_Blame(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	p, _ := newRootProtocol(t, local, DefaultProtocolName, 3, DefaultParams())
+
+	own, idx, err := p.makeResponse()
+	require.NoError(t, err)
+
+	// The response of another node signed with the wrong key
+	other := uint32(idx+1) % 3
+	forged, err := bdn.Sign(p.suite, p.Private(), p.Msg)
+	require.NoError(t, err)
+	mask := make([]byte, 1)
+	mask[0] = 1 << other
+
+	responses := SimpleResponses{uint32(idx): own, other: {Signature: forged, Mask: mask}}
+	sig, culprits, err := p.aggregate(responses)
+	require.NoError(t, err)
+	require.Len(t, culprits, 1)
+	require.Equal(t, other, culprits[0].Index)
+	require.Equal(t, 1, responses.Count())
+
+	// The remaining responses make a valid signature
+	require.NoError(t, sig.VerifyAggregateWithPolicy(testSuite, p.Msg, p.Publics(), anyPolicy{}))
+}
+
+func TestProtocol_FinalAggregate(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	p, _ := newRootProtocol(t, local, DefaultProtocolName, 3, DefaultParams())
+	p.Threshold = 1
+
+	own, idx, err := p.makeResponse()
+	require.NoError(t, err)
+	responses := SimpleResponses{uint32(idx): own}
+	enough, err := p.checkEnough(responses)
+	require.NoError(t, err)
+	require.True(t, enough)
+
+	// The aggregate of checkEnough is reused while the responses are the
+	// same
+	checked := p.checked
+	p.checked = BlsSignature("checked")
+	sig, culprits, err := p.finalAggregate(responses)
+	require.NoError(t, err)
+	require.Empty(t, culprits)
+	require.Equal(t, BlsSignature("checked"), sig)
+
+	// and aggregated again once they changed
+	other := uint32(idx+1) % 3
+	forged, err := bdn.Sign(p.suite, p.Private(), p.Msg)
+	require.NoError(t, err)
+	mask := make([]byte, 1)
+	mask[0] = 1 << other
+	require.NoError(t, responses.Add(int(other), &Response{Signature: forged, Mask: mask}))
+	sig, culprits, err = p.finalAggregate(responses)
+	require.NoError(t, err)
+	require.Len(t, culprits, 1)
+	require.Equal(t, checked, sig)
+}
+
+func TestProtocol_BlameBelowThreshold(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	p, _ := newRootProtocol(t, local, DefaultProtocolName, 2, DefaultParams())
+	p.Threshold = 2
+
+	own, idx, err := p.makeResponse()
+	require.NoError(t, err)
+	other := uint32(idx+1) % 2
+	forged, err := bdn.Sign(p.suite, p.Private(), p.Msg)
+	require.NoError(t, err)
+	mask := make([]byte, 1)
+	mask[0] = 1 << other
+	bad := &Response{Signature: forged, Mask: mask}
+
+	// In tree mode, the two signatures are aggregated together, and ours is
+	// added back once the aggregate is dropped
+	tree, err := NewTreeResponses(p.suite, p.Publics())
+	require.NoError(t, err)
+	for _, responses := range []Responses{SimpleResponses{}, tree} {
+		p.Culprits = nil
+		require.NoError(t, responses.Add(idx, own))
+		require.NoError(t, responses.Update(map[uint32](*Response){other: bad}))
+		require.True(t, p.isEnough(responses))
+
+		// Without the bad signer, the threshold isn't reached anymore
+		enough, err := p.checkEnough(responses)
+		require.NoError(t, err)
+		require.False(t, enough)
+		require.Len(t, p.Culprits, 1)
+		require.Equal(t, 1, responses.Count())
+
+		// The culprit isn't merged again
+		require.Empty(t, p.withoutCulprits(map[uint32](*Response){p.Culprits[0].Index: {
+			Signature: p.Culprits[0].Signature, Mask: p.Culprits[0].Mask}}))
+	}
+}
+
+func TestProtocol_Lifetime(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	params := DefaultParams()
+	params.GossipTick = 10 * time.Millisecond
+	params.Deadline = time.Second
+	params.GossipDeadline = 500 * time.Millisecond
+	params.Linger = 100 * time.Millisecond
+	p, tree := newRootProtocol(t, local, DefaultProtocolName, 7, params)
+	require.NoError(t, p.Start())
+
+	sig, err := waitResult(p)
+	require.NoError(t, err)
+	require.NoError(t, sig.VerifyAggregate(testSuite, p.Msg, tree.Roster.Publics()))
+
+	// Invalid lifetimes are rejected before starting
+	invalid := params
+	invalid.GossipDeadline = 2 * time.Second
+	require.Error(t, invalid.check())
+	invalid = params
+	invalid.Linger = -time.Second
+	require.Error(t, invalid.check())
+	invalid = params
+	invalid.GossipTick = 0
+	require.Error(t, invalid.check())
+}
+
+func TestProtocol_EarlyTermination(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	params := DefaultParams()
+	params.Linger = params.Deadline
+	params.ShutdownQuorum = 3
+	params.QuietPeriod = 200 * time.Millisecond
+	p, _ := newRootProtocol(t, local, DefaultProtocolName, 7, params)
+	require.NoError(t, p.Start())
+
+	_, err := waitResult(p)
+	require.NoError(t, err)
+
+	// Every node terminates long before the end of the linger period
+	require.NoError(t, local.WaitDone(3*time.Second))
+}
+
+func TestProtocol_Failover(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	p, _ := newRootProtocol(t, local, DefaultProtocolName, 3, DefaultParams())
+	p.Threshold = 1
+
+	session, err := p.newSession()
+	require.NoError(t, err)
+	p.session = session
+
+	own, idx, err := p.makeResponse()
+	require.NoError(t, err)
+	finalSig, _, err := p.aggregate(SimpleResponses{uint32(idx): own})
+	require.NoError(t, err)
+	finalizerSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
+	require.NoError(t, err)
+
+	// The shutdown must be signed by the node it names as the finalizer
+	shutdown := Shutdown{session, finalSig, finalizerSig, p.Msg, nil, uint32(idx)}
+	require.NoError(t, p.verifyShutdown(ShutdownMessage{Shutdown: shutdown}))
+	shutdown.Finalizer = uint32(idx+1) % 3
+	require.Error(t, p.verifyShutdown(ShutdownMessage{Shutdown: shutdown}))
+	shutdown.Finalizer = 3
+	require.Error(t, p.verifyShutdown(ShutdownMessage{Shutdown: shutdown}))
+}
+
+func TestProtocol_GracePeriod(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	params := DefaultParams()
+	params.GracePeriod = 5 * time.Second
+	params.TargetCoverage = 100
+	p, tree := newRootProtocol(t, local, DefaultProtocolName, 7, params)
+	require.NoError(t, p.Start())
+
+	// Every node signs before the end of the grace period
+	sig, err := waitResult(p)
+	require.NoError(t, err)
+	mask, err := sig.GetMask(testSuite, tree.Roster.Publics())
+	require.NoError(t, err)
+	require.Equal(t, 7, mask.CountEnabled())
+}
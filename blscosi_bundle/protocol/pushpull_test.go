@@ -0,0 +1,39 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestProtocol_PushPull(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	n := 7
+	_, _, tree := local.GenTree(n, false)
+	pi, err := local.CreateProtocol(DefaultProtocolName, tree)
+	require.NoError(t, err)
+
+	// The root only reaches a threshold of every node if the signatures are
+	// pulled with the digests and their replies.
+	p := pi.(*BlsCosi)
+	p.Msg = []byte("hello push-pull")
+	p.Threshold = n
+	p.Params = DefaultParams()
+	p.Params.PushPull = true
+	p.Params.TreeMode = false
+	require.NoError(t, p.Start())
+
+	select {
+	case sig := <-p.FinalSignature:
+		publics := tree.Roster.Publics()
+		require.NoError(t, sig.VerifyAggregate(testSuite, p.Msg, publics))
+		mask, err := sig.GetMask(testSuite, publics)
+		require.NoError(t, err)
+		require.Equal(t, n, mask.CountEnabled())
+	case <-time.After(20 * time.Second):
+		t.Fatal("the digests didn't converge in time")
+	}
+}
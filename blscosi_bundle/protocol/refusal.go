@@ -0,0 +1,142 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// refusalPrefix separates the refusal statements from the messages that are
+// co-signed, so that a refusal can never be mistaken for a signature.
+const refusalPrefix = "bundleCoSi refusal:"
+
+// ThresholdUnreachableError is returned by the root when so many nodes
+// refused to sign that the threshold cannot be reached anymore. Certificate
+// is the aggregation of the refusals of a quorum of nodes, weighing at least
+// the threshold, which can be checked with BlsSignature.VerifyRefusal. It is
+// nil when the gossip ended before a quorum refused.
+type ThresholdUnreachableError struct {
+	Refusals    int
+	Threshold   int
+	Certificate BlsSignature
+}
+
+func (e *ThresholdUnreachableError) Error() string {
+	return fmt.Sprintf("too many refusals (got %d), the threshold of %d cannot be achieved",
+		e.Refusals, e.Threshold)
+}
+
+// refusalStatement returns the statement signed by a node refusing to
+// co-sign msg.
+func refusalStatement(msg []byte) []byte {
+	statement := make([]byte, 0, len(refusalPrefix)+len(msg))
+	statement = append(statement, refusalPrefix...)
+	return append(statement, msg...)
+}
+
+// makeRefusal signs the refusal statement of the message.
+func (p *BlsCosi) makeRefusal() (*Refusal, error) {
+	sig, err := bdn.Sign(p.suite, p.Private(), refusalStatement(p.statement()))
+	if err != nil {
+		return nil, err
+	}
+	return &Refusal{Signature: sig}, nil
+}
+
+// updateRefusals stores the refusals that we don't know yet, after checking
+// that they are signed by the right node.
+func (p *BlsCosi) updateRefusals(refusals map[uint32]*Refusal) {
+	publics := p.Publics()
+	for idx, refusal := range refusals {
+		if _, ok := p.refusals[idx]; ok {
+			continue
+		}
+		if int(idx) >= len(publics) || refusal == nil {
+			log.Lvl2("Ignoring refusal with invalid index", idx)
+			continue
+		}
+		err := verify(p.suite, refusal.Signature, refusalStatement(p.statement()), publics[idx])
+		if err != nil {
+			log.Lvl1("Ignoring invalid refusal of node", idx, ":", err)
+			continue
+		}
+		p.refusals[idx] = refusal
+	}
+}
+
+// aggregateRefusals aggregates the known refusals into a collective refusal
+// certificate, using the same format as the final signature.
+func (p *BlsCosi) aggregateRefusals() (BlsSignature, error) {
+	mask, err := sign.NewMask(p.suite, p.Publics(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var indices []uint32
+	for idx := range p.refusals {
+		indices = append(indices, idx)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	// The signatures must be in the order of the mask
+	var sigs [][]byte
+	for _, idx := range indices {
+		err = mask.SetBit(int(idx), true)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, p.refusals[idx].Signature)
+	}
+
+	aggSig, err := bdn.AggregateSignatures(p.suite, sigs, mask)
+	if err != nil {
+		return nil, err
+	}
+	data, err := aggSig.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return newBlsSignature(data, mask.Mask(), mask.CountTotal()), nil
+}
+
+// reportAbort sends the refusal certificate made of the known refusals to
+// the client, if they are a quorum.
+func (p *BlsCosi) reportAbort() error {
+	var certificate BlsSignature
+	if p.isRefusalQuorum() {
+		var err error
+		certificate, err = p.aggregateRefusals()
+		if err != nil {
+			return err
+		}
+	}
+	abortErr := &ThresholdUnreachableError{len(p.refusals), p.Threshold, certificate}
+	log.Lvl2(p.ServerIdentity(), "aborts:", abortErr)
+	p.Aborted <- abortErr
+	return nil
+}
+
+// refusalMask returns the mask of the nodes whose refusal is known.
+func (p *BlsCosi) refusalMask() []byte {
+	mask := make([]byte, (len(p.Publics())+7)/8)
+	for idx := range p.refusals {
+		mask[idx/8] |= 1 << (idx % 8)
+	}
+	return mask
+}
+
+// isRefusalQuorum returns true when the known refusals weigh at least the
+// threshold, and make it unreachable.
+func (p *BlsCosi) isRefusalQuorum() bool {
+	return p.weight(p.refusalMask()) >= p.Threshold && p.isUnreachable()
+}
+
+// isUnreachable returns true when the known refusals make the threshold, or
+// the signers required in one of the groups, impossible to reach.
+func (p *BlsCosi) isUnreachable() bool {
+	refusals := p.refusalMask()
+	return p.checkFailureThreshold(p.weight(refusals)) || groupsUnreachable(refusals, p.Groups)
+}
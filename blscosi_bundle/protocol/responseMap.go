@@ -16,7 +16,14 @@ import (
 type Responses interface {
 	Add(idx int, r *Response) error
 	Update(map[uint32](*Response)) error
+	// Remove drops the response stored at idx.
+	Remove(idx uint32)
 	Count() int
+	// Participation returns the mask of the nodes whose signature is known.
+	Participation() []byte
+	// PublicKey checks that the response can be stored at idx, and returns
+	// the public key that verifies its signature.
+	PublicKey(suite pairing.Suite, publics []kyber.Point, idx uint32, r *Response) (kyber.Point, error)
 	// Aggregate aggregates all the signatures in responses.
 	// Also aggregates the bitmasks.
 	Aggregate(suite pairing.Suite, publics []kyber.Point) (kyber.Point, *sign.Mask, error)
@@ -38,10 +45,38 @@ func (responses SimpleResponses) Update(newResponses map[uint32](*Response)) err
 	return nil
 }
 
+func (responses SimpleResponses) Remove(idx uint32) {
+	delete(responses, idx)
+}
+
 func (responses SimpleResponses) Count() int {
 	return len(responses)
 }
 
+func (responses SimpleResponses) Participation() []byte {
+	var mask []byte
+	for _, res := range responses {
+		mask = orMasks(mask, res.Mask)
+	}
+	return mask
+}
+
+func (responses SimpleResponses) PublicKey(suite pairing.Suite, publics []kyber.Point, idx uint32, r *Response) (kyber.Point, error) {
+	mask, err := sign.NewMask(suite, publics, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = mask.SetMask(r.Mask)
+	if err != nil {
+		return nil, err
+	}
+	// Each response holds the raw signature of a single node
+	if mask.CountEnabled() != 1 || mask.IndexOfNthEnabled(0) != int(idx) {
+		return nil, errors.New("response doesn't match its index")
+	}
+	return publics[idx], nil
+}
+
 func (responses SimpleResponses) Aggregate(suite pairing.Suite, publics []kyber.Point) (
 	kyber.Point, *sign.Mask, error) {
 
@@ -254,10 +289,56 @@ func (treeRes TreeResponses) Update(newResponses map[uint32](*Response)) error {
 	return nil
 }
 
+func (treeRes TreeResponses) Remove(idx uint32) {
+	delete(treeRes.responses, idx)
+
+	// Recompute the mask of the remaining responses
+	mask := make([]byte, treeRes.mask.Len())
+	for _, r := range treeRes.responses {
+		mask = orMasks(mask, r.Mask)
+	}
+	treeRes.mask.SetMask(mask)
+}
+
 func (treeRes TreeResponses) Count() int {
 	return treeRes.mask.CountEnabled()
 }
 
+func (treeRes TreeResponses) Participation() []byte {
+	return treeRes.mask.Mask()
+}
+
+func (treeRes TreeResponses) PublicKey(suite pairing.Suite, publics []kyber.Point, idx uint32, r *Response) (kyber.Point, error) {
+	mask, err := sign.NewMask(suite, publics, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = mask.SetMask(r.Mask)
+	if err != nil {
+		return nil, err
+	}
+	if mask.CountEnabled() == 0 || !isSubset(r.Mask, treeRes.leavesMask(idx)) {
+		return nil, errors.New("response doesn't match its index")
+	}
+	// The signatures have already been multiplied with their coefficients
+	return bdn.AggregatePublicKeys(suite, mask)
+}
+
+// leavesMask returns the mask of the nodes below idx in the tree.
+func (treeRes TreeResponses) leavesMask(idx uint32) []byte {
+	mask := make([]byte, (treeRes.total+7)/8)
+	stack := []uint32{idx}
+	for len(stack) > 0 {
+		var current uint32
+		stack, current = stack[:len(stack)-1], stack[len(stack)-1]
+		if current < uint32(treeRes.total) {
+			mask[current/8] |= 1 << (current % 8)
+		}
+		stack = append(stack, treeRes.tree[current]...)
+	}
+	return mask
+}
+
 func (treeRes TreeResponses) Aggregate(suite pairing.Suite, publics []kyber.Point) (
 	kyber.Point, *sign.Mask, error) {
 
@@ -284,3 +365,15 @@ func (treeRes TreeResponses) Aggregate(suite pairing.Suite, publics []kyber.Poin
 func (treeRes TreeResponses) Map() map[uint32](*Response) {
 	return treeRes.responses
 }
+
+// missingResponses returns the responses that contain at least one signature
+// whose bit is not enabled in the known participation mask.
+func missingResponses(responses map[uint32](*Response), known []byte) map[uint32](*Response) {
+	missing := make(map[uint32](*Response))
+	for k, resp := range responses {
+		if !isSubset(resp.Mask, known) {
+			missing[k] = resp
+		}
+	}
+	return missing
+}
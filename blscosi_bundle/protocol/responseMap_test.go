@@ -0,0 +1,24 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingResponses(t *testing.T) {
+	responses := map[uint32](*Response){
+		0: {Mask: []byte{0x01}},
+		1: {Mask: []byte{0x02}},
+		8: {Mask: []byte{0x0c}},
+		9: {Mask: []byte{0x00, 0x01}},
+	}
+
+	missing := missingResponses(responses, []byte{0x07})
+	require.Len(t, missing, 2)
+	require.Contains(t, missing, uint32(8))
+	require.Contains(t, missing, uint32(9))
+
+	require.Len(t, missingResponses(responses, nil), len(responses))
+	require.Empty(t, missingResponses(responses, []byte{0xff, 0xff}))
+}
@@ -0,0 +1,155 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/protobuf"
+)
+
+// sessionPrefix separates the session headers from the other statements
+// signed with the same keys.
+const sessionPrefix = "bundleCoSi session:"
+
+const nonceSize = 32
+
+// digest returns the hash of the header that is signed by the root.
+func (s *Session) digest(suite pairing.Suite) ([]byte, error) {
+	params, err := protobuf.Encode(&s.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	h := suite.Hash()
+	h.Write([]byte(sessionPrefix))
+	h.Write(s.MsgHash)
+	h.Write(s.DataHash)
+	h.Write(params)
+	binary.Write(h, binary.BigEndian, uint32(s.Threshold))
+	binary.Write(h, binary.BigEndian, uint32(len(s.Weights)))
+	for _, w := range s.Weights {
+		binary.Write(h, binary.BigEndian, uint32(w))
+	}
+	binary.Write(h, binary.BigEndian, uint32(len(s.Groups)))
+	for _, g := range s.Groups {
+		binary.Write(h, binary.BigEndian, uint32(len(g.Name)))
+		h.Write([]byte(g.Name))
+		binary.Write(h, binary.BigEndian, uint32(g.K))
+		binary.Write(h, binary.BigEndian, uint32(len(g.Members)))
+		for _, idx := range g.Members {
+			binary.Write(h, binary.BigEndian, idx)
+		}
+	}
+	h.Write(s.RosterID[:])
+	h.Write(s.Nonce)
+	return h.Sum(nil), nil
+}
+
+// hashMsg returns the hash of the message, or of the verification data,
+// that is announced in the session.
+func (p *BlsCosi) hashMsg(msg []byte) []byte {
+	h := p.suite.Hash()
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// newSession creates the session header for the current message and
+// parameters, and signs it. Only the root does this.
+func (p *BlsCosi) newSession() (Session, error) {
+	nonce := make([]byte, nonceSize)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return Session{}, err
+	}
+
+	session := Session{
+		MsgHash:   p.hashMsg(p.Msg),
+		DataHash:  p.hashMsg(p.Data),
+		Params:    p.Params,
+		Threshold: p.Threshold,
+		Weights:   p.Weights,
+		Groups:    p.Groups,
+		RosterID:  p.Roster().ID,
+		Nonce:     nonce,
+	}
+	digest, err := session.digest(p.suite)
+	if err != nil {
+		return Session{}, err
+	}
+	session.Signature, err = bdn.Sign(p.suite, p.Private(), digest)
+	return session, err
+}
+
+// verifySession checks that the session header has been signed by the root
+// for our roster, and that it announces the given message.
+//
+// The root of the tree is the node that leads the session, which is any node
+// of the roster that a client asked to sign. The session is checked with the
+// key of the root rather than the first key of the roster, so it can't be
+// replayed on a tree rooted at another node.
+func (p *BlsCosi) verifySession(session Session, msg []byte) error {
+	if len(p.Publics()) == 0 {
+		return errors.New("Roster is empty")
+	}
+	if session.RosterID != p.Roster().ID {
+		return errors.New("session announced for another roster")
+	}
+	if !bytes.Equal(session.MsgHash, p.hashMsg(msg)) {
+		return errors.New("message doesn't match the session")
+	}
+	if err := session.Params.check(); err != nil {
+		return err
+	}
+	if err := checkWeights(session.Weights, len(p.Publics())); err != nil {
+		return err
+	}
+	if err := checkGroups(session.Groups, len(p.Publics())); err != nil {
+		return err
+	}
+	if session.Threshold < 1 || session.Threshold > TotalWeight(session.Weights, len(p.Publics())) {
+		return fmt.Errorf("invalid threshold of %d in the session", session.Threshold)
+	}
+
+	digest, err := session.digest(p.suite)
+	if err != nil {
+		return err
+	}
+	return verify(p.suite, session.Signature, digest, p.Publics()[p.Root().RosterIndex])
+}
+
+// verifyData checks that the verification data is the one announced in the
+// verified session.
+func (p *BlsCosi) verifyData(session Session, data []byte) error {
+	if !bytes.Equal(session.DataHash, p.hashMsg(data)) {
+		return errors.New("verification data doesn't match the session")
+	}
+	return nil
+}
+
+// adoptSession sets the protocol up for a session announced by the root. The
+// session must have been verified.
+func (p *BlsCosi) adoptSession(session Session) {
+	p.session = session
+	p.Params = session.Params
+	p.Threshold = session.Threshold
+	p.Weights = session.Weights
+	p.Groups = session.Groups
+}
+
+// Session returns the session header signed by the root, once the node
+// knows it.
+func (p *BlsCosi) Session() Session {
+	return p.session
+}
+
+// isSession returns true if the header is the one of the current session.
+// The header must have been verified when the session was adopted.
+func (p *BlsCosi) isSession(session Session) bool {
+	return bytes.Equal(session.Nonce, p.session.Nonce) &&
+		bytes.Equal(session.Signature, p.session.Signature)
+}
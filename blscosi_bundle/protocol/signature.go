@@ -15,7 +15,8 @@ import (
 type BlsSignature []byte
 
 // GetMask creates and returns the mask associated with the signature. If
-// no mask has been appended, mask with every bit enabled is assumed
+// no mask has been appended, mask with every bit enabled is assumed. The
+// mask can be in any of the encodings of EncodeMask.
 func (sig BlsSignature) GetMask(suite pairing.Suite, publics []kyber.Point) (*sign.Mask, error) {
 	mask, err := sign.NewMask(suite, publics, nil)
 	if err != nil {
@@ -27,7 +28,11 @@ func (sig BlsSignature) GetMask(suite pairing.Suite, publics []kyber.Point) (*si
 		return nil, errors.New("signature too short to get mask")
 	}
 
-	err = mask.SetMask(sig[lenCom:])
+	bits, err := DecodeMask(sig[lenCom:], len(publics))
+	if err != nil {
+		return nil, err
+	}
+	err = mask.SetMask(bits)
 	if err != nil {
 		return nil, err
 	}
@@ -54,6 +59,12 @@ func (sig BlsSignature) Point(suite pairing.Suite) (kyber.Point, error) {
 	return pointSig, nil
 }
 
+// newBlsSignature appends the participation mask of n nodes to the raw
+// signature, in its shortest encoding.
+func newBlsSignature(rawSig []byte, mask []byte, n int) BlsSignature {
+	return append(rawSig, EncodeMask(mask, n)...)
+}
+
 // VerifyAggregate checks the signature over the message using the public keys and a default policy
 func (sig BlsSignature) VerifyAggregate(suite pairing.Suite, msg []byte, publics []kyber.Point) error {
 	policy := sign.NewThresholdPolicy(DefaultThreshold(len(publics)))
@@ -102,3 +113,27 @@ func (sig BlsSignature) VerifyAggregateWithPolicy(suite pairing.Suite, msg []byt
 
 	return nil
 }
+
+// VerifyRefusal checks that the signature is a collective refusal of the
+// message by a quorum of nodes for the default threshold, which also makes
+// that threshold unreachable.
+func (sig BlsSignature) VerifyRefusal(suite pairing.Suite, msg []byte, publics []kyber.Point) error {
+	policy := NewRefusalPolicy(nil, DefaultThreshold(len(publics)), nil)
+	return sig.VerifyRefusalWithPolicy(suite, msg, publics, policy)
+}
+
+// VerifyRefusalWithPolicy checks that the signature is a collective refusal
+// of the message using the given public keys and policy
+func (sig BlsSignature) VerifyRefusalWithPolicy(suite pairing.Suite, msg []byte, publics []kyber.Point, policy sign.Policy) error {
+	if msg == nil {
+		return errors.New("no message provided")
+	}
+	return sig.VerifyAggregateWithPolicy(suite, refusalStatement(msg), publics, policy)
+}
+
+// anyPolicy accepts every mask, to only check the validity of a signature
+type anyPolicy struct{}
+
+func (anyPolicy) Check(m *sign.Mask) bool {
+	return true
+}
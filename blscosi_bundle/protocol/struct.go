@@ -11,14 +11,45 @@ import (
 const DefaultProtocolName = "bundleCoSiDefault"
 
 func init() {
-	network.RegisterMessages(&Rumor{}, &Shutdown{}, &Response{}, &Stop{})
+	network.RegisterMessages(&Rumor{}, &Digest{}, &Shutdown{}, &Response{}, &Stop{})
 }
 
-// Rumor is a struct that can be sent in the gossip protocol
+// Session is the header of a signing session. It is signed by the root, so
+// that the other nodes only sign the message with the verification data, and
+// adopt the parameters, the threshold, the weights and the groups that the
+// root announced for this roster.
+type Session struct {
+	MsgHash   []byte
+	DataHash  []byte
+	Params    Parameters
+	Threshold int
+	Weights   []int
+	Groups    []Group
+	RosterID  onet.RosterID
+	Nonce     []byte
+	Signature []byte
+}
+
+// Rumor is a struct that can be sent in the gossip protocol.
+// In delta mode, ResponseMap only holds the responses that the target is not
+// known to have. Participation always describes every signature known to
+// the sender, so that the target can send deltas back.
+// Refusals holds every signed refusal known to the sender. Data is the
+// additional data for the verification, only sent to the peers that may
+// not have it yet.
+// In compact mode, the responses are sent in Compact instead of ResponseMap,
+// and the session and the message are only sent to the peers that may not
+// have them yet. The other rumors only hold SessionRef, the nonce of the
+// session.
 type Rumor struct {
-	Params      Parameters
-	ResponseMap map[uint32](*Response)
-	Msg         []byte
+	Session       Session
+	ResponseMap   map[uint32](*Response)
+	Msg           []byte
+	Participation []byte
+	Refusals      map[uint32]*Refusal
+	Data          []byte
+	SessionRef    []byte
+	Compact       []CompactResponse
 }
 
 // RumorMessage just contains a Rumor and the data necessary to identify and
@@ -28,16 +59,41 @@ type RumorMessage struct {
 	Rumor
 }
 
+// Digest is sent instead of a rumor in push-pull mode. It only contains the
+// participation mask of the sender, and the target replies with a rumor
+// holding the signatures that the sender lacks. If the sender holds
+// signatures that the target lacks, the target also replies with its own
+// digest, flagged as a reply so that it isn't answered by another digest.
+// An empty digest asks for every known signature. The known refusals are
+// exchanged the same way, using the Refused mask.
+type Digest struct {
+	Participation []byte
+	Refused       []byte
+	Reply         bool
+}
+
+// DigestMessage just contains a Digest and the data necessary to identify
+// and process the message in the onet framework.
+type DigestMessage struct {
+	*onet.TreeNode
+	Digest
+}
+
 // Shutdown is a struct that can be sent in the gossip protocol
-// A valid shutdown message must contain a proof that the root has seen a valid
+// A valid shutdown message must contain a proof that a node has seen a valid
 // final signature. This is to prevent faked shutdown messages that take down the
 // gossip protocol. Thus the shutdown message contains the final signature,
-// which in turn is signed by root.
+// which in turn is signed by the node that aggregated it, usually the root.
+// Finalizer is the index of that node in the roster.
+// When the protocol is aborted, the final signature is replaced by enough
+// signed refusals to prove that the threshold cannot be reached.
 type Shutdown struct {
-	Params           Parameters
+	Session          Session
 	FinalCoSignature BlsSignature
 	RootSig          []byte
 	Msg              []byte
+	Refusals         map[uint32]*Refusal
+	Finalizer        uint32
 }
 
 // ShutdownMessage just contains a Shutdown and the data necessary to identify
@@ -53,7 +109,8 @@ type Response struct {
 	Mask      []byte
 }
 
-// Refusal is the signed refusal response from a given node
+// Refusal is the signed refusal response from a given node. The signature is
+// made over the refusal statement of the message.
 type Refusal struct {
 	Signature []byte
 }
@@ -0,0 +1,16 @@
+package protocol
+
+import (
+	"fmt"
+
+	"go.dedis.ch/kyber/v3/pairing"
+)
+
+// SuiteName returns the name of the suite, as registered in kyber for the
+// suites that have one.
+func SuiteName(suite pairing.Suite) string {
+	if s, ok := suite.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return suite.G1().String()
+}
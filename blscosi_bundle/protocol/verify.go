@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"fmt"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign/bls"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// mergeRumor verifies the responses of the rumor and adds them to ours. The
+// sender of invalid responses is blacklisted for the rest of the session and
+// nothing it sent is used.
+func (p *BlsCosi) mergeRumor(responses Responses, rumor RumorMessage) error {
+	if rumor.TreeNode != nil && p.peer(rumor.TreeNode).blacklisted {
+		log.Lvl3("Ignoring rumor from blacklisted", rumor.ServerIdentity)
+		return nil
+	}
+
+	received, err := expandResponses(rumor.Rumor, len(p.Publics()))
+	if err == nil {
+		received, err = p.verifyResponses(responses, p.withoutCulprits(received))
+	}
+	if err != nil {
+		log.Lvl1("Blacklisting", rumor.ServerIdentity, "for this session:", err)
+		if rumor.TreeNode != nil {
+			p.peer(rumor.TreeNode).blacklisted = true
+		}
+		return nil
+	}
+
+	p.learnRumor(rumor)
+	err = responses.Update(received)
+	if err != nil {
+		return err
+	}
+	p.updateRefusals(rumor.Refusals)
+	return nil
+}
+
+// verifyResponses returns the received responses that bring new signatures,
+// after checking them. An error is returned if any of them is invalid.
+func (p *BlsCosi) verifyResponses(responses Responses, received map[uint32](*Response)) (
+	map[uint32](*Response), error) {
+
+	if !p.Params.VerifyResponses {
+		return received, nil
+	}
+
+	candidates := missingResponses(received, responses.Participation())
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	publics := p.Publics()
+	var keys []kyber.Point
+	var sigs [][]byte
+	var indices []uint32
+	for idx, r := range candidates {
+		key, err := responses.PublicKey(p.suite, publics, idx, r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response %d: %s", idx, err)
+		}
+		keys = append(keys, key)
+		sigs = append(sigs, r.Signature)
+		indices = append(indices, idx)
+	}
+
+	if p.Params.BatchVerify && len(sigs) > 1 {
+		if batchVerify(p.suite, p.statement(), keys, sigs) == nil {
+			return candidates, nil
+		}
+		log.Lvl3("Batch verification failed, checking every response")
+	}
+
+	for i := range sigs {
+		err := bls.Verify(p.suite, keys[i], p.statement(), sigs[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature in response %d: %s", indices[i], err)
+		}
+	}
+	return candidates, nil
+}
+
+// batchVerify checks all the signatures of the message at once. They are
+// combined with random coefficients so that invalid signatures can't cancel
+// each other out.
+func batchVerify(suite pairing.Suite, msg []byte, keys []kyber.Point, sigs [][]byte) error {
+	aggKey := suite.G2().Point().Null()
+	aggSig := suite.G1().Point().Null()
+	for i := range sigs {
+		sig := suite.G1().Point()
+		err := sig.UnmarshalBinary(sigs[i])
+		if err != nil {
+			return err
+		}
+		r := suite.G1().Scalar().Pick(random.New())
+		aggSig = aggSig.Add(aggSig, sig.Mul(r, sig))
+		aggKey = aggKey.Add(aggKey, suite.G2().Point().Mul(r, keys[i]))
+	}
+
+	data, err := aggSig.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return bls.Verify(suite, aggKey, msg, data)
+}
@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"fmt"
+
+	"go.dedis.ch/kyber/v3/sign"
+)
+
+// WeightedPolicy is a sign.Policy that requires the sum of the weights of
+// the signers to reach a threshold. Without weights, every node weighs one
+// and it is equivalent to a sign.ThresholdPolicy.
+type WeightedPolicy struct {
+	Weights   []int
+	Threshold int
+}
+
+// NewWeightedPolicy returns a policy requiring the given total weight, where
+// weights are given in the order of the roster.
+func NewWeightedPolicy(weights []int, threshold int) *WeightedPolicy {
+	return &WeightedPolicy{Weights: weights, Threshold: threshold}
+}
+
+// Check returns true if the signers of the mask weigh enough.
+func (p *WeightedPolicy) Check(m *sign.Mask) bool {
+	return MaskWeight(m.Mask(), p.Weights) >= p.Threshold
+}
+
+// MaskWeight returns the sum of the weights of the nodes enabled in the
+// mask. Without weights, every node weighs one.
+func MaskWeight(mask []byte, weights []int) int {
+	weight := 0
+	for i := 0; i < len(mask)*8; i++ {
+		if !isBitSet(mask, i) {
+			continue
+		}
+		if weights == nil {
+			weight++
+		} else if i < len(weights) {
+			weight += weights[i]
+		}
+	}
+	return weight
+}
+
+// TotalWeight returns the weight of the n nodes of the roster.
+func TotalWeight(weights []int, n int) int {
+	if weights == nil {
+		return n
+	}
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	return total
+}
+
+// checkWeights returns an error if the weights can't be used for a roster
+// of n nodes.
+func checkWeights(weights []int, n int) error {
+	if weights == nil {
+		return nil
+	}
+	if len(weights) != n {
+		return fmt.Errorf("got %d weights for %d nodes", len(weights), n)
+	}
+	for i, w := range weights {
+		if w < 0 {
+			return fmt.Errorf("negative weight for node %d", i)
+		}
+	}
+	return nil
+}
+
+// weight returns the weight of the nodes enabled in the mask.
+func (p *BlsCosi) weight(mask []byte) int {
+	return MaskWeight(mask, p.Weights)
+}
+
+// totalWeight returns the weight of the whole roster.
+func (p *BlsCosi) totalWeight() int {
+	return TotalWeight(p.Weights, len(p.Publics()))
+}
+
+// policy returns the policy that the final signature must fulfil.
+func (p *BlsCosi) policy() sign.Policy {
+	if len(p.Groups) == 0 {
+		return NewWeightedPolicy(p.Weights, p.Threshold)
+	}
+	return AllPolicies{NewWeightedPolicy(p.Weights, p.Threshold), NewGroupPolicy(p.Groups)}
+}
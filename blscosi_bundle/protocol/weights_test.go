@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestWeightedPolicy(t *testing.T) {
+	publics := make([]kyber.Point, 4)
+	for i := range publics {
+		_, publics[i] = bdn.NewKeyPair(testSuite, random.New())
+	}
+	mask, err := sign.NewMask(testSuite, publics, nil)
+	require.NoError(t, err)
+	require.NoError(t, mask.SetBit(0, true))
+	require.NoError(t, mask.SetBit(2, true))
+
+	weights := []int{5, 1, 2, 1}
+	require.Equal(t, 7, MaskWeight(mask.Mask(), weights))
+	require.Equal(t, 2, MaskWeight(mask.Mask(), nil))
+	require.Equal(t, 9, TotalWeight(weights, 4))
+	require.Equal(t, 4, TotalWeight(nil, 4))
+
+	require.True(t, NewWeightedPolicy(weights, 7).Check(mask))
+	require.False(t, NewWeightedPolicy(weights, 8).Check(mask))
+	require.True(t, NewWeightedPolicy(nil, 2).Check(mask))
+
+	require.Error(t, checkWeights([]int{1, 2}, 4))
+	require.Error(t, checkWeights([]int{1, -1, 1, 1}, 4))
+	require.NoError(t, checkWeights(nil, 4))
+}
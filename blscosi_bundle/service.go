@@ -4,7 +4,8 @@ package blscosi_bundle
 
 import (
 	"errors"
-	"time"
+	"fmt"
+	"sync"
 
 	"github.com/dedis/student_19_gossip_bls/blscosi_bundle/protocol"
 	"go.dedis.ch/kyber/v3/pairing"
@@ -14,9 +15,37 @@ import (
 	"go.dedis.ch/onet/v3/network"
 )
 
-const protocolTimeout = 20 * time.Second
+// suite is the pairing suite of the service registered under ServiceName.
+var suite = pairing.NewSuiteBn256()
 
-var suite = suites.MustFind("bn256.adapter").(*pairing.SuiteBn256)
+// registered is a service registered with RegisterService.
+type registered struct {
+	name  string
+	suite pairing.Suite
+}
+
+// services holds the registered services by the name of their suite
+var services = make(map[string]registered)
+var servicesLock sync.Mutex
+
+// FindService returns the name of the service registered with the pairing
+// suite of the given name, as written in the signature containers, and the
+// suite itself.
+func FindService(suiteName string) (string, pairing.Suite, error) {
+	servicesLock.Lock()
+	defer servicesLock.Unlock()
+	s, ok := services[suiteName]
+	if !ok {
+		return "", nil, fmt.Errorf("no service registered with the suite %s", suiteName)
+	}
+	return s.name, s.suite, nil
+}
+
+// Suite returns the pairing suite of the service registered under
+// ServiceName, which its signatures are made with.
+func Suite() pairing.Suite {
+	return suite
+}
 
 // ServiceID is the key to get the service later
 var ServiceID onet.ServiceID
@@ -25,9 +54,39 @@ var ServiceID onet.ServiceID
 const ServiceName = "bundleCoSiService"
 
 func init() {
-	ServiceID, _ = onet.RegisterNewServiceWithSuite(ServiceName, suite, newCoSiService)
+	ServiceID, _ = RegisterService(ServiceName, suite)
 	network.RegisterMessage(&SignatureRequest{})
 	network.RegisterMessage(&SignatureResponse{})
+	network.RegisterMessage(&ResultRequest{})
+	network.RegisterMessage(&SignatureStreamRequest{})
+	network.RegisterMessage(&SignatureProgress{})
+	network.RegisterMessage(&PingRequest{})
+	network.RegisterMessage(&PingResponse{})
+}
+
+// DefaultVerification is the name of the verification function used when
+// a request doesn't name one. No function is registered under it by
+// default, so such requests are rejected unless the operator registers one
+// with GlobalRegisterVerification or RegisterVerification.
+const DefaultVerification = ""
+
+// globalVerifications are the verification functions registered on every
+// service created afterwards
+var globalVerifications = make(map[string]protocol.VerificationFn)
+var globalVerificationsLock sync.Mutex
+
+// GlobalRegisterVerification makes the verification function available to
+// the requests under the given name on every service created afterwards. It
+// should be called before the server starts, most likely in an init
+// function.
+func GlobalRegisterVerification(name string, vf protocol.VerificationFn) error {
+	if vf == nil {
+		return errors.New("verification function cannot be nil")
+	}
+	globalVerificationsLock.Lock()
+	defer globalVerificationsLock.Unlock()
+	globalVerifications[name] = vf
+	return nil
 }
 
 // Service is the service that handles collective signing operations
@@ -35,42 +94,205 @@ type Service struct {
 	*onet.ServiceProcessor
 	suite     pairing.Suite
 	Threshold int
-	Timeout   time.Duration
+
+	verifications     map[string]protocol.VerificationFn
+	verificationsLock sync.Mutex
+	results           map[string]*SignatureResponse // final signatures by session, see resultKey
+	resultsOrder      []string                      // keys of the results, oldest first
+	resultsLock       sync.Mutex
 }
 
+// maxResults is the number of final signatures that a node keeps for the
+// ResultRequests, the oldest ones are dropped first.
+const maxResults = 256
+
 // SignatureRequest is what the Cosi service is expected to receive from clients.
+// Data is passed along with the message to the verification function of
+// every node. Verification is the name of the verification function that
+// every node uses, which must have been registered on all of them. Policy
+// sets the number of signatures required, the threshold of the service is
+// used when it is the zero value. Weights gives the weight of each node of
+// the roster, in which case the policy applies to the sum of the weights.
+// Groups additionally requires enough signers in each group of nodes.
 type SignatureRequest struct {
-	Message []byte
-	Roster  *onet.Roster
-	Params  protocol.Parameters
+	Message      []byte
+	Data         []byte
+	Roster       *onet.Roster
+	Params       protocol.Parameters
+	Verification string
+	Policy       protocol.Policy
+	Weights      []int
+	Groups       []protocol.Group
 }
 
+// Status is the outcome of a signing session.
+type Status int
+
+const (
+	// StatusComplete means that the signature has enough signers.
+	StatusComplete Status = iota
+	// StatusBelowThreshold means that the session ended before enough nodes
+	// signed, the signature is partial.
+	StatusBelowThreshold
+	// StatusAborted means that the cothority refused to sign.
+	StatusAborted
+)
+
 // SignatureResponse is what the Cosi service will reply to clients.
+// When Refusal is true, the cothority refused to sign the message and
+// Signature is a collective refusal certificate instead, to be checked with
+// BlsSignature.VerifyRefusal. Culprits are the invalid responses that were
+// dropped from the signature, kept as evidence. Threshold is the number of
+// signatures that was required, in weight units when Weights is set.
+// Signers is the number of nodes in the mask of Signature, Weight their
+// weight, and Missing holds the roster indices of the others. Groups are
+// the groups that needed enough signers, if any. Context is set when the
+// signature is bound to the session, and must be used for the verification.
 type SignatureResponse struct {
 	Hash      []byte
 	Signature protocol.BlsSignature
+	Refusal   bool
+	Culprits  []protocol.Culprit
+	Threshold int
+	Status    Status
+	Signers   int
+	Missing   []uint32
+	Weights   []int
+	Weight    int
+	Groups    []protocol.Group
+	Context   *protocol.SigningContext
+}
+
+// ResultRequest asks a node for the last final signature it knows for the
+// message with the given hash, signed by the roster with the given ID along
+// with the data with the given hash. Any node that finalized a signature in
+// place of the root can answer it. The signature includes the signatures
+// that the node collected after the end of the session, if any.
+type ResultRequest struct {
+	Hash     []byte
+	RosterID onet.RosterID
+	DataHash []byte
 }
 
+// PingRequest asks a node whether its service can be reached. The client
+// uses it to tell the errors of the service from the failures of the node.
+type PingRequest struct{}
+
+// PingResponse is the reply to PingRequest.
+type PingResponse struct{}
+
+// SignatureStreamRequest asks for a signature like SignatureRequest, and
+// streams the progress of the session.
+type SignatureStreamRequest struct {
+	Request *SignatureRequest
+}
+
+// SignatureProgress is an event of a signing session streamed to the client.
+// The last event of a session holds either the final response or an error.
+type SignatureProgress struct {
+	Progress protocol.Progress
+	Final    *SignatureResponse
+	Error    string
+}
+
+// progressBuffer is the number of progress events kept for a slow client
+const progressBuffer = 16
+
 // SignatureRequest treats external request to this service.
 func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, error) {
-	// generate the tree
-	rooted := req.Roster.NewRosterWithRoot(s.ServerIdentity())
-	if rooted == nil {
-		return nil, errors.New("we're not in the roster")
+	p, err := s.startSession(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.waitResult(p)
+	if err != nil {
+		return nil, err
 	}
-	tree := rooted.GenerateStar()
+	return res, nil
+}
+
+// SignatureStream treats external request to this service, and streams the
+// progress of the session until the final signature.
+func (s *Service) SignatureStream(req *SignatureStreamRequest) (chan *SignatureProgress, chan bool, error) {
+	if req.Request == nil {
+		return nil, nil, errors.New("no signature request")
+	}
+	progress := make(chan protocol.Progress, progressBuffer)
+	p, err := s.startSession(req.Request, progress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	final := make(chan *SignatureProgress, 1)
+	go func() {
+		res, err := s.waitResult(p)
+		if err != nil {
+			final <- &SignatureProgress{Error: err.Error()}
+		} else {
+			final <- &SignatureProgress{Final: res}
+		}
+	}()
+
+	events := make(chan *SignatureProgress)
+	stop := make(chan bool)
+	go func() {
+		defer close(events)
+		for {
+			var event *SignatureProgress
+			select {
+			case pr := <-progress:
+				event = &SignatureProgress{Progress: pr}
+			case event = <-final:
+			case <-stop:
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-stop:
+				return
+			}
+			if event.Final != nil || event.Error != "" {
+				return
+			}
+		}
+	}()
+	return events, stop, nil
+}
+
+// startSession starts the protocol for the request, with this node as root.
+// progress receives the progress of the session if it is not nil.
+func (s *Service) startSession(req *SignatureRequest, progress chan protocol.Progress) (*protocol.BlsCosi, error) {
+	// generate the tree
+	tree := starTree(req.Roster, s.ServerIdentity())
 	if tree == nil {
-		return nil, errors.New("failed to generate tree")
+		return nil, errors.New("we're not in the roster")
 	}
 
 	// configure the BlsCosi protocol
-	pi, err := s.CreateProtocol(protocol.DefaultProtocolName, tree)
+	vf, err := s.verification(req.Verification)
+	if err != nil {
+		return nil, err
+	}
+	tni := s.NewTreeNodeInstance(tree, tree.Root, protocol.DefaultProtocolName)
+	// The other nodes learn the name of the verification function from the
+	// protocol configuration
+	err = tni.SetConfig(&onet.GenericConfig{Data: []byte(req.Verification)})
+	if err != nil {
+		return nil, err
+	}
+	pi, err := protocol.NewBlsCosi(tni, vf, s.suite)
 	if err != nil {
 		return nil, errors.New("Couldn't make new protocol: " + err.Error())
 	}
+	if err = s.RegisterProtocolInstance(pi); err != nil {
+		return nil, err
+	}
 	p := pi.(*protocol.BlsCosi)
-	p.Timeout = s.Timeout
+	p.Progress = progress
 	p.Msg = req.Message
+	p.Data = req.Data
+	p.Groups = req.Groups
 	p.Params = req.Params
 	if p.Params == (protocol.Parameters{}) {
 		p.Params = protocol.DefaultParams()
@@ -78,7 +300,20 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 
 	// Threshold before the subtrees so that we can optimize situation
 	// like a threshold of one
-	if s.Threshold > 0 {
+	if len(req.Weights) > 0 {
+		// The threshold of the service counts nodes, the policy is applied
+		// to the total weight instead
+		p.Weights = req.Weights
+		p.Threshold, err = req.Policy.Threshold(protocol.TotalWeight(req.Weights, len(tree.Roster.List)))
+		if err != nil {
+			return nil, err
+		}
+	} else if req.Policy != (protocol.Policy{}) {
+		p.Threshold, err = req.Policy.Threshold(len(tree.Roster.List))
+		if err != nil {
+			return nil, err
+		}
+	} else if s.Threshold > 0 {
 		p.Threshold = s.Threshold
 	}
 
@@ -87,15 +322,166 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 	if err = pi.Start(); err != nil {
 		return nil, err
 	}
+	return p, nil
+}
 
-	// wait for reply. This will always eventually return.
-	sig := <-p.FinalSignature
+// waitResult waits for the outcome of the session. This will always
+// eventually return.
+func (s *Service) waitResult(p *protocol.BlsCosi) (*SignatureResponse, error) {
+	select {
+	case sig := <-p.FinalSignature:
+		res, err := s.newResponse(p, sig, false)
+		if err != nil {
+			return nil, err
+		}
+		s.storeResult(p, res)
+		go s.collectImproved(p)
+		return res, nil
+	case err := <-p.Aborted:
+		if refused, ok := err.(*protocol.ThresholdUnreachableError); ok && refused.Certificate != nil {
+			return s.newResponse(p, refused.Certificate, true)
+		}
+		return nil, err
+	}
+}
 
+// newResponse describes the outcome of the session for the client.
+func (s *Service) newResponse(p *protocol.BlsCosi, sig protocol.BlsSignature, refusal bool) (*SignatureResponse, error) {
 	// The hash is the message blscosi actually signs, we recompute it the
 	// same way as blscosi and then return it.
 	h := s.suite.Hash()
-	h.Write(req.Message)
-	return &SignatureResponse{h.Sum(nil), sig}, nil
+	h.Write(p.Msg)
+
+	mask, err := sig.GetMask(s.suite, p.Publics())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SignatureResponse{
+		Hash:      h.Sum(nil),
+		Signature: sig,
+		Refusal:   refusal,
+		Threshold: p.Threshold,
+		Signers:   mask.CountEnabled(),
+		Weights:   p.Weights,
+		Weight:    protocol.MaskWeight(mask.Mask(), p.Weights),
+		Groups:    p.Groups,
+		Context:   p.SigningContext(),
+	}
+	bits := mask.Mask()
+	for i := 0; i < mask.CountTotal(); i++ {
+		if bits[i/8]&(1<<uint(i%8)) == 0 {
+			res.Missing = append(res.Missing, uint32(i))
+		}
+	}
+
+	switch {
+	case refusal:
+		res.Status = StatusAborted
+	case res.Weight >= res.Threshold && protocol.NewGroupPolicy(p.Groups).Check(mask):
+		res.Status = StatusComplete
+		res.Culprits = p.Culprits
+	default:
+		res.Status = StatusBelowThreshold
+		res.Culprits = p.Culprits
+	}
+	return res, nil
+}
+
+// starTree generates a star tree rooted at the given server. Contrary to
+// Roster.GenerateStar on a rooted roster, the roster keeps its order, so that
+// the signature can be verified with the roster of the request whichever
+// node leads the session.
+func starTree(roster *onet.Roster, si *network.ServerIdentity) *onet.Tree {
+	index, _ := roster.Search(si.ID)
+	if index < 0 {
+		return nil
+	}
+	root := onet.NewTreeNode(index, roster.List[index])
+	for i, child := range roster.List {
+		if i != index {
+			root.AddChild(onet.NewTreeNode(i, child))
+		}
+	}
+	return onet.NewTree(roster, root)
+}
+
+// PingRequest always answers, as long as the service runs.
+func (s *Service) PingRequest(req *PingRequest) (network.Message, error) {
+	return &PingResponse{}, nil
+}
+
+// ResultRequest returns the final signature of a message that this node
+// knows.
+func (s *Service) ResultRequest(req *ResultRequest) (network.Message, error) {
+	s.resultsLock.Lock()
+	defer s.resultsLock.Unlock()
+	res, ok := s.results[resultKey(req.RosterID, req.Hash, req.DataHash)]
+	if !ok {
+		return nil, errors.New("no final signature known for this message")
+	}
+	return res, nil
+}
+
+// resultKey identifies the session that signed the message with the given
+// hash, for the roster with the given ID and the data with the given hash.
+// The hashes have a fixed length, so the key is unambiguous.
+func resultKey(rosterID onet.RosterID, msgHash, dataHash []byte) string {
+	return string(rosterID[:]) + string(msgHash) + string(dataHash)
+}
+
+// storeResult keeps the final signature of the session so that it can be
+// fetched later. It replaces the signature of the same session, and drops
+// the oldest one when there are more than maxResults. The key is taken from
+// the session signed by the root, as a node may not have received the data.
+func (s *Service) storeResult(p *protocol.BlsCosi, res *SignatureResponse) {
+	session := p.Session()
+	if session.DataHash == nil {
+		log.Lvl2("Not storing the signature of an unknown session")
+		return
+	}
+	key := resultKey(session.RosterID, session.MsgHash, session.DataHash)
+	s.resultsLock.Lock()
+	defer s.resultsLock.Unlock()
+	if _, ok := s.results[key]; !ok {
+		s.resultsOrder = append(s.resultsOrder, key)
+	}
+	s.results[key] = res
+	if len(s.resultsOrder) > maxResults {
+		delete(s.results, s.resultsOrder[0])
+		s.resultsOrder = s.resultsOrder[1:]
+	}
+}
+
+// collectResult stores the signature that the node aggregates if it takes
+// over from the root.
+func (s *Service) collectResult(p *protocol.BlsCosi) {
+	sig, ok := <-p.FinalSignature
+	if !ok {
+		return
+	}
+	res, err := s.newResponse(p, sig, false)
+	if err != nil {
+		log.Error("couldn't describe the final signature:", err)
+		return
+	}
+	s.storeResult(p, res)
+	s.collectImproved(p)
+}
+
+// collectImproved replaces the stored signature with the improved one, if
+// the node collected more signatures after the end of the session.
+func (s *Service) collectImproved(p *protocol.BlsCosi) {
+	sig, ok := <-p.Improved
+	if !ok {
+		return
+	}
+	res, err := s.newResponse(p, sig, false)
+	if err != nil {
+		log.Error("couldn't describe the improved signature:", err)
+		return
+	}
+	s.storeResult(p, res)
 }
 
 // NewProtocol is called on all nodes of a Tree (except the root, since it is
@@ -106,20 +492,100 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 	if tn.ProtocolName() != protocol.DefaultProtocolName {
 		return nil, errors.New("no such protocol " + tn.ProtocolName())
 	}
-	return protocol.NewDefaultProtocol(tn)
+
+	name := DefaultVerification
+	if conf != nil {
+		name = string(conf.Data)
+	}
+	vf, err := s.verification(name)
+	if err != nil {
+		return nil, err
+	}
+	pi, err := protocol.NewBlsCosi(tn, vf, s.suite)
+	if err != nil {
+		return nil, err
+	}
+	go s.collectResult(pi.(*protocol.BlsCosi))
+	return pi, nil
+}
+
+// RegisterVerification makes the verification function available to the
+// requests under the given name. It should be called at startup, on every
+// node of the rosters that will use it. Registering an existing name
+// replaces its function.
+func (s *Service) RegisterVerification(name string, vf protocol.VerificationFn) error {
+	if vf == nil {
+		return errors.New("verification function cannot be nil")
+	}
+	s.verificationsLock.Lock()
+	defer s.verificationsLock.Unlock()
+	s.verifications[name] = vf
+	return nil
 }
 
-func newCoSiService(c *onet.Context) (onet.Service, error) {
+// verification returns the verification function registered under the
+// given name.
+func (s *Service) verification(name string) (protocol.VerificationFn, error) {
+	s.verificationsLock.Lock()
+	defer s.verificationsLock.Unlock()
+	vf, ok := s.verifications[name]
+	if !ok && name == DefaultVerification {
+		return nil, errors.New("no verification function named and no default one registered")
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown verification function %q", name)
+	}
+	return vf, nil
+}
+
+// RegisterService registers the service under the given name, signing with
+// the given pairing suite. The service of ServiceName signs with the bn256
+// adapter, another suite needs another name, and a suite can only be used
+// by one service. The suite must also be a suite of onet, for the keys of
+// the servers, as the adapters are.
+func RegisterService(name string, suite pairing.Suite) (onet.ServiceID, error) {
+	s, ok := suite.(suites.Suite)
+	if !ok {
+		return onet.ServiceID{}, fmt.Errorf("%s can't be used for the keys of the servers", protocol.SuiteName(suite))
+	}
+
+	servicesLock.Lock()
+	defer servicesLock.Unlock()
+	suiteName := protocol.SuiteName(suite)
+	if other, ok := services[suiteName]; ok {
+		return onet.ServiceID{}, fmt.Errorf("the suite %s is already used by %s", suiteName, other.name)
+	}
+	id, err := onet.RegisterNewServiceWithSuite(name, s, func(c *onet.Context) (onet.Service, error) {
+		return newCoSiService(c, suite)
+	})
+	if err != nil {
+		return onet.ServiceID{}, err
+	}
+	services[suiteName] = registered{name: name, suite: suite}
+	return id, nil
+}
+
+func newCoSiService(c *onet.Context, suite pairing.Suite) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		suite:            suite,
-		Timeout:          protocolTimeout,
+		verifications:    make(map[string]protocol.VerificationFn),
+		results:          make(map[string]*SignatureResponse),
 	}
+	globalVerificationsLock.Lock()
+	for name, vf := range globalVerifications {
+		s.verifications[name] = vf
+	}
+	globalVerificationsLock.Unlock()
 
-	if err := s.RegisterHandler(s.SignatureRequest); err != nil {
+	if err := s.RegisterHandlers(s.SignatureRequest, s.ResultRequest, s.PingRequest); err != nil {
 		log.Error("couldn't register message:", err)
 		return nil, err
 	}
+	if err := s.RegisterStreamingHandler(s.SignatureStream); err != nil {
+		log.Error("couldn't register streaming message:", err)
+		return nil, err
+	}
 
 	return s, nil
 }
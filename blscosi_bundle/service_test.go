@@ -2,10 +2,12 @@ package blscosi_bundle
 
 import (
 	"testing"
+	"time"
 
+	"github.com/dedis/student_19_gossip_bls/blscosi_bundle/protocol"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
-	"go.dedis.ch/kyber/v3/sign/cosi"
+	"go.dedis.ch/kyber/v3/sign"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 )
@@ -16,12 +18,24 @@ func TestMain(m *testing.M) {
 	log.MainTest(m)
 }
 
+// acceptAll registers a default verification accepting every message on the
+// services of the hosts.
+func acceptAll(t *testing.T, hosts []*onet.Server) {
+	for _, host := range hosts {
+		service := host.Service(ServiceName).(*Service)
+		require.NoError(t, service.RegisterVerification(DefaultVerification, func(msg, data []byte) bool {
+			return true
+		}))
+	}
+}
+
 func TestService_SignatureRequest(t *testing.T) {
 	local := onet.NewTCPTest(testSuite)
 	// generate 5 hosts, they don't connect, they process messages, and they
 	// don't register the tree or entitylist
 	hosts, roster, _ := local.GenTree(10, false)
 	defer local.CloseAll()
+	acceptAll(t, hosts)
 
 	service := hosts[0].Service(ServiceName).(*Service)
 
@@ -37,17 +51,8 @@ func TestService_SignatureRequest(t *testing.T) {
 	})
 	require.Contains(t, err.Error(), "we're not in the roster")
 
-	// wrong subtree number should fail
-	ro2 := roster
-	service.NSubtrees = len(roster.List) + 1
-	_, err = service.SignatureRequest(&SignatureRequest{
-		Roster:  ro2,
-		Message: msg,
-	})
-	require.NotNil(t, err)
-
 	// missing message should fail
-	service.NSubtrees = 3
+	ro2 := roster
 	service.Threshold = 1
 	_, err = service.SignatureRequest(&SignatureRequest{
 		Roster:  ro2,
@@ -66,5 +71,357 @@ func TestService_SignatureRequest(t *testing.T) {
 	res := buf.(*SignatureResponse)
 
 	// verify the response still
-	require.Nil(t, res.Signature.VerifyWithPolicy(testSuite, msg, publics, cosi.NewThresholdPolicy(1)))
+	require.Nil(t, res.Signature.VerifyAggregateWithPolicy(testSuite, msg, publics, sign.NewThresholdPolicy(1)))
+}
+
+func TestService_Verification(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	for _, host := range hosts {
+		service := host.Service(ServiceName).(*Service)
+		require.Error(t, service.RegisterVerification("refuse", nil))
+		require.NoError(t, service.RegisterVerification("refuse", func(msg, data []byte) bool {
+			return false
+		}))
+	}
+	service := hosts[0].Service(ServiceName).(*Service)
+	msg := []byte("hello blscosi_bundle service")
+
+	// unknown verification function
+	_, err := service.SignatureRequest(&SignatureRequest{
+		Roster:       roster,
+		Message:      msg,
+		Verification: "unknown",
+	})
+	require.Error(t, err)
+
+	// every node refuses
+	buf, err := service.SignatureRequest(&SignatureRequest{
+		Roster:       roster,
+		Message:      msg,
+		Verification: "refuse",
+	})
+	require.NoError(t, err)
+	res := buf.(*SignatureResponse)
+	require.True(t, res.Refusal)
+	require.NoError(t, res.Signature.VerifyRefusal(testSuite, msg, roster.ServicePublics(ServiceName)))
+}
+
+func TestService_NoVerification(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	// Nothing accepts the requests naming no verification by default
+	service := hosts[0].Service(ServiceName).(*Service)
+	req := &SignatureRequest{
+		Roster:  roster,
+		Message: []byte("hello blscosi_bundle service"),
+	}
+	_, err := service.SignatureRequest(req)
+	require.Error(t, err)
+
+	acceptAll(t, hosts)
+	_, err = service.SignatureRequest(req)
+	require.NoError(t, err)
+}
+
+func TestService_UnregisteredVerification(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	// Only the root knows the verification function of the session
+	service := hosts[0].Service(ServiceName).(*Service)
+	require.NoError(t, service.RegisterVerification("rootOnly", func(msg, data []byte) bool {
+		return true
+	}))
+
+	params := protocol.DefaultParams()
+	params.Deadline = 2 * time.Second
+	params.GossipDeadline = time.Second
+	buf, err := service.SignatureRequest(&SignatureRequest{
+		Roster:       roster,
+		Message:      []byte("hello blscosi_bundle service"),
+		Params:       params,
+		Verification: "rootOnly",
+	})
+	require.NoError(t, err)
+
+	// The other nodes refuse to take part instead of using another function
+	res := buf.(*SignatureResponse)
+	require.Equal(t, StatusBelowThreshold, res.Status)
+	require.Equal(t, 1, res.Signers)
+	require.Equal(t, []uint32{1, 2, 3, 4}, res.Missing)
+}
+
+func TestService_Policy(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+	acceptAll(t, hosts)
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	msg := []byte("hello blscosi_bundle service")
+
+	_, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Policy:  protocol.Policy{Model: protocol.ExplicitQuorum, K: 6},
+	})
+	require.Error(t, err)
+
+	buf, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Policy:  protocol.Policy{Model: protocol.MajorityQuorum},
+	})
+	require.NoError(t, err)
+	res := buf.(*SignatureResponse)
+	require.Equal(t, 3, res.Threshold)
+
+	publics := roster.ServicePublics(ServiceName)
+	policy := sign.NewThresholdPolicy(res.Threshold)
+	require.NoError(t, res.Signature.VerifyAggregateWithPolicy(testSuite, msg, publics, policy))
+}
+
+func TestService_Result(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+	acceptAll(t, hosts)
+
+	client := NewClient()
+	msg := []byte("hello blscosi_bundle service")
+	req := &SignatureRequest{Roster: roster, Message: msg}
+	_, err := client.Result(roster.List[0], req)
+	require.Error(t, err)
+
+	res, err := client.SignatureRequest(roster, msg)
+	require.NoError(t, err)
+
+	// The root keeps the final signature
+	stored, err := client.Result(roster.List[0], req)
+	require.NoError(t, err)
+	require.Equal(t, res.Signature, stored.Signature)
+
+	// It is only returned for the same session
+	_, err = client.Result(roster.List[0], &SignatureRequest{Roster: roster, Message: msg, Data: []byte("data")})
+	require.Error(t, err)
+	_, err = client.Result(roster.List[0], &SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Policy:  protocol.Policy{Model: protocol.ExplicitQuorum, K: 5},
+	})
+	require.Error(t, err)
+}
+
+func TestService_Leaderless(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+	acceptAll(t, hosts)
+
+	client := NewClient()
+	msg := []byte("hello blscosi_bundle service")
+	params := protocol.DefaultParams()
+	params.Leaderless = true
+	req := &SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Data:    []byte("leaderless data"),
+		Params:  params,
+	}
+	_, err := client.send(roster, req)
+	require.NoError(t, err)
+
+	// Every node ends with a final signature, stored for the data of the
+	// session even if the node only got the shutdown
+	publics := roster.ServicePublics(ServiceName)
+	for _, si := range roster.List {
+		var res *SignatureResponse
+		for i := 0; i < 10; i++ {
+			res, err = client.Result(si, req)
+			if err == nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		require.NoError(t, err)
+		require.NoError(t, res.Signature.VerifyAggregate(testSuite, msg, publics))
+
+		_, err = client.Result(si, &SignatureRequest{Roster: roster, Message: msg, Params: params})
+		require.Error(t, err)
+	}
+}
+
+func TestService_Failover(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	// The other nodes sign slowly, so that the root is paused before it
+	// gets enough signatures
+	started := make(chan bool, len(hosts))
+	for i, host := range hosts {
+		root := i == 0
+		service := host.Service(ServiceName).(*Service)
+		require.NoError(t, service.RegisterVerification("slow", func(msg, data []byte) bool {
+			if !root {
+				started <- true
+				time.Sleep(500 * time.Millisecond)
+			}
+			return true
+		}))
+	}
+
+	msg := []byte("hello blscosi_bundle service")
+	params := protocol.DefaultParams()
+	params.Deadline = 5 * time.Second
+	params.GossipDeadline = 4 * time.Second
+	params.FailoverAfter = 2 * time.Second
+	req := &SignatureRequest{
+		Roster:       roster,
+		Message:      msg,
+		Params:       params,
+		Verification: "slow",
+	}
+	done := make(chan error)
+	go func() {
+		_, err := hosts[0].Service(ServiceName).(*Service).SignatureRequest(req)
+		done <- err
+	}()
+
+	<-started
+	hosts[0].Pause()
+
+	// Another node finalizes the signature and the client gets it
+	client := NewClient()
+	publics := roster.ServicePublics(ServiceName)
+	var res *SignatureResponse
+	var err error
+	for i := 0; i < 50 && res == nil; i++ {
+		for _, si := range roster.List[1:] {
+			res, err = client.Result(si, req)
+			if err == nil {
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	require.NoError(t, res.Signature.VerifyAggregate(testSuite, msg, publics))
+
+	hosts[0].Unpause()
+	<-done
+}
+
+func TestService_AnyLeader(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+	acceptAll(t, hosts)
+
+	// The signature doesn't depend on the node leading the session
+	service := hosts[2].Service(ServiceName).(*Service)
+	msg := []byte("hello blscosi_bundle service")
+	buf, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.NoError(t, err)
+	res := buf.(*SignatureResponse)
+	require.NoError(t, res.Signature.VerifyAggregate(testSuite, msg, roster.ServicePublics(ServiceName)))
+}
+
+func TestService_Partial(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	// The last node is too slow to sign before the gossip deadline
+	for i, host := range hosts {
+		slow := i == len(hosts)-1
+		service := host.Service(ServiceName).(*Service)
+		require.NoError(t, service.RegisterVerification("slow", func(msg, data []byte) bool {
+			if slow {
+				time.Sleep(2 * time.Second)
+			}
+			return true
+		}))
+	}
+
+	params := protocol.DefaultParams()
+	params.Deadline = 3 * time.Second
+	params.GossipDeadline = time.Second
+	_, err := NewClient().send(roster, &SignatureRequest{
+		Roster:       roster,
+		Message:      []byte("hello blscosi_bundle service"),
+		Params:       params,
+		Verification: "slow",
+		Policy:       protocol.Policy{Model: protocol.ExplicitQuorum, K: 5},
+	})
+	require.Error(t, err)
+	require.IsType(t, &PartialSignatureError{}, err)
+
+	res := err.(*PartialSignatureError).Response
+	require.Equal(t, StatusBelowThreshold, res.Status)
+	require.Equal(t, 4, res.Signers)
+	require.Equal(t, []uint32{4}, res.Missing)
+}
+
+func TestService_SignatureStream(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+	acceptAll(t, hosts)
+
+	msg := []byte("hello blscosi_bundle service")
+	events, err := NewClient().SignatureRequestStream(roster, msg, nil)
+	require.NoError(t, err)
+
+	var progress []protocol.Progress
+	var final *SignatureResponse
+	for event := range events {
+		require.Empty(t, event.Error)
+		if event.Final != nil {
+			final = event.Final
+		} else {
+			progress = append(progress, event.Progress)
+		}
+	}
+
+	require.NotEmpty(t, progress)
+	require.NotNil(t, final)
+	require.NoError(t, final.Signature.VerifyAggregate(testSuite, msg, roster.ServicePublics(ServiceName)))
+}
+
+func TestService_SignatureStreamStop(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+	acceptAll(t, hosts)
+
+	// The first node can't be reached, the next one streams the session
+	hosts[0].Close()
+	done := make(chan struct{})
+	events, err := NewClient().SignatureRequestStream(roster, []byte("hello blscosi_bundle service"), done)
+	require.NoError(t, err)
+
+	// The stream ends once the caller stops reading it
+	<-events
+	close(done)
+	closed := make(chan bool)
+	go func() {
+		for range events {
+		}
+		closed <- true
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the stream didn't stop")
+	}
 }
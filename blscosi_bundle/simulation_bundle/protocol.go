@@ -38,18 +38,40 @@ const roundSleep = 4 * time.Second
 
 func init() {
 	onet.SimulationRegister("BlsCosiBundleProtocol", NewSimulationProtocol)
+	// The nodes of the simulation sign every message
+	err := blscosi.GlobalRegisterVerification(blscosi.DefaultVerification, func(msg, data []byte) bool {
+		return true
+	})
+	log.ErrFatal(err)
 }
 
 // SimulationProtocol implements onet.Simulation.
 type SimulationProtocol struct {
 	onet.SimulationBFTree
-	FailingLeaves int
-	MinDelay      float64
-	MaxDelay      float64
-	GossipTick    float64
-	RumorPeers    int
-	ShutdownPeers int
-	TreeMode      int
+	FailingLeaves   int
+	MinDelay        float64
+	MaxDelay        float64
+	GossipTick      float64
+	RumorPeers      int
+	ShutdownPeers   int
+	TreeMode        int
+	PeerSelection   int
+	DeltaRumors     int
+	FullRumorPeriod int
+	PushPull        int
+	CompactRumors   int
+	VerifyResponses int
+	BatchVerify     int
+	Deadline        float64
+	GossipDeadline  float64
+	Linger          float64
+	ShutdownQuorum  int
+	QuietPeriod     float64
+	FailoverAfter   float64
+	Leaderless      int
+	GracePeriod     float64
+	TargetCoverage  int
+	BindSession     int
 }
 
 // NewSimulationProtocol is used internally to register the simulation (see the init()
@@ -98,7 +120,7 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 			}
 
 			switch msg.(type) {
-			case *protocol.Rumor, *protocol.Shutdown:
+			case *protocol.Rumor, *protocol.Digest, *protocol.Shutdown:
 				sleepSecs := rand.Float64()*(s.MaxDelay-s.MinDelay) + s.MinDelay
 				sleepNsecs := sleepSecs * float64(time.Second/time.Nanosecond)
 				log.Lvlf3("Delaying message by %.3f for simulation on %v", sleepSecs, config.Server.ServerIdentity)
@@ -128,7 +150,7 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 				}
 
 				switch msg.(type) {
-				case *protocol.Rumor, *protocol.Shutdown:
+				case *protocol.Rumor, *protocol.Digest, *protocol.Shutdown:
 					log.Lvl2("Ignoring blscosi message for simulation on ", config.Server.ServerIdentity)
 				default:
 					config.Overlay.Process(e)
@@ -158,11 +180,30 @@ func (s *SimulationProtocol) Run(config *onet.SimulationConfig) error {
 		blscosiService.Threshold = s.Hosts - (s.Hosts-1)/3
 
 		params := protocol.Parameters{
-			GossipTick:    time.Duration(s.GossipTick * float64(time.Second/time.Nanosecond)),
-			RumorPeers:    s.RumorPeers,
-			ShutdownPeers: s.ShutdownPeers,
-			TreeMode:      s.TreeMode != 0,
+			GossipTick:      time.Duration(s.GossipTick * float64(time.Second/time.Nanosecond)),
+			RumorPeers:      s.RumorPeers,
+			ShutdownPeers:   s.ShutdownPeers,
+			TreeMode:        s.TreeMode != 0,
+			PeerSelection:   protocol.PeerSelection(s.PeerSelection),
+			DeltaRumors:     s.DeltaRumors != 0,
+			FullRumorPeriod: s.FullRumorPeriod,
+			PushPull:        s.PushPull != 0,
+			CompactRumors:   s.CompactRumors != 0,
+			VerifyResponses: s.VerifyResponses != 0,
+			BatchVerify:     s.BatchVerify != 0,
+			ShutdownQuorum:  s.ShutdownQuorum,
+			QuietPeriod:     time.Duration(s.QuietPeriod * float64(time.Second/time.Nanosecond)),
+			FailoverAfter:   time.Duration(s.FailoverAfter * float64(time.Second/time.Nanosecond)),
+			Leaderless:      s.Leaderless != 0,
+			GracePeriod:     time.Duration(s.GracePeriod * float64(time.Second/time.Nanosecond)),
+			TargetCoverage:  s.TargetCoverage,
+			BindSession:     s.BindSession != 0,
 		}
+		// The lifetime of the protocol is optional in the configuration
+		defaults := protocol.DefaultParams()
+		params.Deadline = seconds(s.Deadline, defaults.Deadline)
+		params.GossipDeadline = seconds(s.GossipDeadline, defaults.GossipDeadline)
+		params.Linger = seconds(s.Linger, defaults.Linger)
 
 		client := blscosi.NewClient()
 		proposal := []byte{0xFF}
@@ -196,3 +237,12 @@ func (s *SimulationProtocol) Run(config *onet.SimulationConfig) error {
 	}
 	return nil
 }
+
+// seconds converts a number of seconds of the configuration to a duration,
+// or returns the default one when it is not set.
+func seconds(secs float64, def time.Duration) time.Duration {
+	if secs <= 0 {
+		return def
+	}
+	return time.Duration(secs * float64(time.Second/time.Nanosecond))
+}
@@ -0,0 +1,37 @@
+package protocol
+
+import (
+	"errors"
+	"time"
+)
+
+// Parameters holds the lifetime of the protocol
+type Parameters struct {
+	Deadline       time.Duration // hard deadline of the protocol on every node
+	GossipDeadline time.Duration // the gossip stops after that, even without enough signatures
+	Linger         time.Duration // time a node keeps answering with shutdowns once it is done
+}
+
+// DefaultParams returns a set of default parameters
+func DefaultParams() Parameters {
+	return Parameters{
+		Deadline:       11 * time.Second,
+		GossipDeadline: 10 * time.Second,
+		Linger:         time.Second,
+	}
+}
+
+// check returns an error if the parameters can't be used to run the
+// protocol
+func (params Parameters) check() error {
+	if params.Deadline < 500*time.Microsecond {
+		return errors.New("unrealistic deadline")
+	}
+	if params.GossipDeadline <= 0 || params.GossipDeadline > params.Deadline {
+		return errors.New("gossip deadline must be positive and before the deadline")
+	}
+	if params.Linger < 0 || params.Linger > params.Deadline {
+		return errors.New("linger must be positive and shorter than the deadline")
+	}
+	return nil
+}
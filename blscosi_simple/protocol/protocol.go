@@ -17,8 +17,6 @@ import (
 	"go.dedis.ch/onet/v3/log"
 )
 
-const defaultTimeout = 10 * time.Second
-const shutdownAfter = 11 * time.Second // finally truly shutdown the protocol
 const gossipTick = 100 * time.Millisecond
 
 const rumorPeers = 2    // number of peers that a rumor message is sent to
@@ -41,9 +39,9 @@ type BlsCosi struct {
 	*onet.TreeNodeInstance
 	Msg  []byte
 	Data []byte
-	// Timeout is not a global timeout for the protocol, but a timeout used
-	// for waiting for responses.
-	Timeout        time.Duration
+	// Params is the lifetime of the protocol, the root sends it to the
+	// other nodes with the message.
+	Params         Parameters
 	Threshold      int
 	FinalSignature chan BlsSignature // final signature that is sent back to client
 
@@ -84,7 +82,7 @@ func NewBlsCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite *pairing.Suit
 	c := &BlsCosi{
 		TreeNodeInstance: n,
 		FinalSignature:   make(chan BlsSignature, 1),
-		Timeout:          defaultTimeout,
+		Params:           DefaultParams(),
 		Threshold:        DefaultThreshold(nNodes),
 		startChan:        make(chan bool, 1),
 		verificationFn:   vf,
@@ -112,7 +110,11 @@ func (p *BlsCosi) Shutdown() error {
 func (p *BlsCosi) Dispatch() error {
 	defer p.Done()
 
-	protocolTimeout := time.After(shutdownAfter)
+	// The other nodes use the default lifetime until they get the one of the
+	// root with the message
+	start := time.Now()
+	deadline := time.After(p.Params.Deadline)
+	gossipDeadline := time.After(p.Params.GossipDeadline)
 
 	// responses is a map where we collect all signatures.
 	responses := make(ResponseMap)
@@ -159,6 +161,13 @@ func (p *BlsCosi) Dispatch() error {
 
 			if len(p.Msg) == 0 && len(rumor.Msg) > 0 {
 				p.Msg = rumor.Msg[:]
+				if err := rumor.Params.check(); err == nil {
+					p.Params = rumor.Params
+					deadline = time.After(time.Until(start.Add(p.Params.Deadline)))
+					gossipDeadline = time.After(time.Until(start.Add(p.Params.GossipDeadline)))
+				} else {
+					log.Lvl2("Keeping the default lifetime:", err)
+				}
 				// Add own signature.
 				err := p.trySign(responses)
 				if err != nil {
@@ -177,7 +186,9 @@ func (p *BlsCosi) Dispatch() error {
 		case <-ticker.C:
 			log.Lvl5("Outgoing rumor")
 			p.sendRumors(responses)
-		case <-protocolTimeout:
+		case <-gossipDeadline:
+			shutdown = true
+		case <-deadline:
 			shutdown = true
 			done = true
 		}
@@ -216,6 +227,7 @@ func (p *BlsCosi) Dispatch() error {
 	// We respond to every non-shutdown message with a shutdown message, to
 	// ensure that all nodes will shut down eventually. This is also the reason
 	// why we don't immediately do a hard shutdown.
+	linger := time.After(p.Params.Linger)
 	for !done {
 		select {
 		case rumor := <-p.RumorsChan:
@@ -224,7 +236,9 @@ func (p *BlsCosi) Dispatch() error {
 			p.sendShutdown(sender, shutdownStruct)
 		case <-p.ShutdownChan:
 			// ignore
-		case <-protocolTimeout:
+		case <-linger:
+			done = true
+		case <-deadline:
 			done = true
 		}
 	}
@@ -262,7 +276,7 @@ func (p *BlsCosi) sendRumors(responses ResponseMap) {
 
 // sendRumor sends the given signatures to a random peer.
 func (p *BlsCosi) sendRumor(target *onet.TreeNode, responses ResponseMap) {
-	p.SendTo(target, &Rumor{responses, p.Msg})
+	p.SendTo(target, &Rumor{responses, p.Msg, p.Params})
 }
 
 // sendShutdowns sends a shutdown message to some random peers.
@@ -369,15 +383,15 @@ func (p *BlsCosi) checkIntegrity() error {
 	if p.verificationFn == nil {
 		return fmt.Errorf("verification function cannot be nil")
 	}
-	if p.Timeout < 500*time.Microsecond {
-		return fmt.Errorf("unrealistic timeout")
-	}
 	if p.Threshold > p.Tree().Size() {
 		return fmt.Errorf("threshold (%d) bigger than number of nodes (%d)", p.Threshold, p.Tree().Size())
 	}
 	if p.Threshold < 1 {
 		return fmt.Errorf("threshold of %d smaller than one node", p.Threshold)
 	}
+	if err := p.Params.check(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -113,6 +113,7 @@ func (sig BlsSignature) VerifyWithPolicy(ps pairing.Suite, msg []byte, publics [
 type Rumor struct {
 	ResponseMap ResponseMap
 	Msg         []byte
+	Params      Parameters
 }
 
 // RumorMessage just contains a Rumor and the data necessary to identify and
@@ -4,7 +4,6 @@ package blscosi_simple
 
 import (
 	"errors"
-	"time"
 
 	"github.com/dedis/student_19_gossip_bls/blscosi_simple/protocol"
 	"go.dedis.ch/kyber/v3/pairing"
@@ -14,8 +13,6 @@ import (
 	"go.dedis.ch/onet/v3/network"
 )
 
-const protocolTimeout = 20 * time.Second
-
 var suite = suites.MustFind("bn256.adapter").(*pairing.SuiteBn256)
 
 // ServiceID is the key to get the service later
@@ -35,13 +32,13 @@ type Service struct {
 	*onet.ServiceProcessor
 	suite     pairing.Suite
 	Threshold int
-	Timeout   time.Duration
 }
 
 // SignatureRequest is what the Cosi service is expected to receive from clients.
 type SignatureRequest struct {
 	Message []byte
 	Roster  *onet.Roster
+	Params  protocol.Parameters // lifetime of the protocol, the default one if empty
 }
 
 // SignatureResponse is what the Cosi service will reply to clients.
@@ -68,7 +65,9 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 		return nil, errors.New("Couldn't make new protocol: " + err.Error())
 	}
 	p := pi.(*protocol.BlsCosi)
-	p.Timeout = s.Timeout
+	if req.Params != (protocol.Parameters{}) {
+		p.Params = req.Params
+	}
 	p.Msg = req.Message
 
 	// Threshold before the subtrees so that we can optimize situation
@@ -108,7 +107,6 @@ func newCoSiService(c *onet.Context) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		suite:            suite,
-		Timeout:          protocolTimeout,
 	}
 
 	if err := s.RegisterHandler(s.SignatureRequest); err != nil {
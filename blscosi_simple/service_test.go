@@ -2,7 +2,9 @@ package blscosi_simple
 
 import (
 	"testing"
+	"time"
 
+	"github.com/dedis/student_19_gossip_bls/blscosi_simple/protocol"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/sign/cosi"
@@ -68,3 +70,31 @@ func TestService_SignatureRequest(t *testing.T) {
 	// verify the response still
 	require.Nil(t, res.Signature.VerifyWithPolicy(testSuite, msg, publics, cosi.NewThresholdPolicy(1)))
 }
+
+func TestService_Params(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	msg := []byte("hello blscosi_simple params")
+
+	// the gossip can't last longer than the protocol
+	_, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Params:  protocol.Parameters{Deadline: time.Second, GossipDeadline: 2 * time.Second},
+	})
+	require.Error(t, err)
+
+	// a short session still gets all the signatures
+	params := protocol.Parameters{Deadline: 3 * time.Second, GossipDeadline: 2 * time.Second, Linger: 500 * time.Millisecond}
+	buf, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Params:  params,
+	})
+	require.NoError(t, err)
+	res := buf.(*SignatureResponse)
+	require.NoError(t, res.Signature.Verify(testSuite, msg, roster.ServicePublics(ServiceName)))
+}
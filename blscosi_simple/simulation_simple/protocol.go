@@ -21,6 +21,7 @@ In the Node-method you can read the files that have been created by the
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	blscosi "github.com/dedis/student_19_gossip_bls/blscosi_simple"
@@ -39,7 +40,10 @@ func init() {
 // SimulationProtocol implements onet.Simulation.
 type SimulationProtocol struct {
 	onet.SimulationBFTree
-	FailingLeaves int
+	FailingLeaves  int
+	Deadline       float64
+	GossipDeadline float64
+	Linger         float64
 }
 
 // NewSimulationProtocol is used internally to register the simulation (see the init()
@@ -119,11 +123,20 @@ func (s *SimulationProtocol) Run(config *onet.SimulationConfig) error {
 		blscosiService := config.GetService(blscosi.ServiceName).(*blscosi.Service)
 		blscosiService.Threshold = s.Hosts - s.FailingLeaves
 
+		// The lifetime of the protocol is optional in the configuration
+		defaults := protocol.DefaultParams()
+		params := protocol.Parameters{
+			Deadline:       seconds(s.Deadline, defaults.Deadline),
+			GossipDeadline: seconds(s.GossipDeadline, defaults.GossipDeadline),
+			Linger:         seconds(s.Linger, defaults.Linger),
+		}
+
 		client := blscosi.NewClient()
 		proposal := []byte{0xFF}
 		serviceReq := &blscosi.SignatureRequest{
 			Roster:  config.Roster,
 			Message: proposal,
+			Params:  params,
 		}
 		serviceReply := &blscosi.SignatureResponse{}
 
@@ -150,3 +163,12 @@ func (s *SimulationProtocol) Run(config *onet.SimulationConfig) error {
 	}
 	return nil
 }
+
+// seconds converts a duration in seconds of the configuration, or returns
+// the default one when it isn't set
+func seconds(secs float64, def time.Duration) time.Duration {
+	if secs <= 0 {
+		return def
+	}
+	return time.Duration(secs * float64(time.Second/time.Nanosecond))
+}